@@ -0,0 +1,328 @@
+package badger
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxHistogramBuckets limits the size of histograms (including the empty
+// buckets), so a few outlying values can't eat all the memory
+const maxHistogramBuckets = 100000
+
+// DateInterval is the bucket size for DateHistogram
+type DateInterval int
+
+const (
+	Day DateInterval = iota
+	Week
+	Month
+	Year
+)
+
+// DateBucket is a single bucket in a date histogram
+type DateBucket struct {
+	// Start is the first day of the bucket (UTC). Weeks start on Monday.
+	Start time.Time
+	Count int
+}
+
+// bucketStart returns the start of the bucket containing t
+func (interval DateInterval) bucketStart(t time.Time) time.Time {
+	switch interval {
+	case Week:
+		// days since monday
+		offset := (int(t.Weekday()) + 6) % 7
+		return t.AddDate(0, 0, -offset)
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case Year:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t
+}
+
+// next returns the start of the bucket after the one starting at t
+func (interval DateInterval) next(t time.Time) time.Time {
+	switch interval {
+	case Week:
+		return t.AddDate(0, 0, 7)
+	case Month:
+		return t.AddDate(0, 1, 0)
+	case Year:
+		return t.AddDate(1, 0, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// count returns the number of buckets needed to cover the buckets starting
+// at first and last (inclusive)
+func (interval DateInterval) count(first, last time.Time) int {
+	switch interval {
+	case Week:
+		return int(epochDays(last)-epochDays(first))/7 + 1
+	case Month:
+		return (last.Year()-first.Year())*12 + int(last.Month()) - int(first.Month()) + 1
+	case Year:
+		return last.Year() - first.Year() + 1
+	}
+	return int(epochDays(last)-epochDays(first)) + 1
+}
+
+// epochDays returns the number of days from 1970-01-01 to t (which should be
+// midnight UTC).
+// (time.Duration can only cover about 292 years, so t.Sub won't do)
+func epochDays(t time.Time) int64 {
+	return t.Unix() / (24 * 60 * 60)
+}
+
+// DateHistogram counts the docs matching a query by date, bucketed by
+// interval. Dates are picked out of string fields the same way date range
+// queries do it (ie by looking for YYYY-MM-DD). Docs without a date are
+// ignored.
+// Buckets are returned in order, from the earliest date to the latest,
+// including any empty buckets in between. Returns ErrTooManyBuckets if
+// that would be an unreasonable number of buckets.
+func (coll *Collection) DateHistogram(q Query, field string, interval DateInterval) ([]DateBucket, error) {
+	if interval < Day || interval > Year {
+		return nil, fmt.Errorf("bad date interval (%d)", interval)
+	}
+
+	coll.RLock()
+	defer coll.RUnlock()
+	ids, err := coll.perform(q)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := coll.queryField(field)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[time.Time]int{}
+	var first, last time.Time
+	for id, _ := range ids {
+		seen := map[time.Time]struct{}{}
+		for _, val := range fp.docStrings(coll.docs[id]) {
+			date := dateExtractPat.FindString(val)
+			if date == "" {
+				continue
+			}
+			t, err := time.Parse("2006-01-02", date)
+			if err != nil {
+				// eg "2010-13-45"
+				continue
+			}
+			start := interval.bucketStart(t)
+			if _, got := seen[start]; got {
+				continue
+			}
+			seen[start] = struct{}{}
+			// (can't use IsZero to spot an unset first, as 0001-01-01
+			// is a valid date)
+			if len(counts) == 0 || start.Before(first) {
+				first = start
+			}
+			if len(counts) == 0 || start.After(last) {
+				last = start
+			}
+			counts[start]++
+		}
+	}
+
+	buckets := []DateBucket{}
+	if len(counts) == 0 {
+		return buckets, nil
+	}
+	n := interval.count(first, last)
+	if n > maxHistogramBuckets {
+		return nil, fmt.Errorf("%w (%d)", ErrTooManyBuckets, n)
+	}
+	t := first
+	for i := 0; i < n; i++ {
+		buckets = append(buckets, DateBucket{t, counts[t]})
+		t = interval.next(t)
+	}
+	return buckets, nil
+}
+
+// AggOp is a statistic to calculate with Aggregate
+type AggOp struct {
+	kind aggKind
+	// for percentiles
+	p float64
+}
+
+type aggKind int
+
+const (
+	aggCount aggKind = iota
+	aggMin
+	aggMax
+	aggSum
+	aggMean
+	aggPercentile
+)
+
+var (
+	AggCount = AggOp{kind: aggCount}
+	AggMin   = AggOp{kind: aggMin}
+	AggMax   = AggOp{kind: aggMax}
+	AggSum   = AggOp{kind: aggSum}
+	AggMean  = AggOp{kind: aggMean}
+)
+
+// AggPercentile returns an op to calculate the pth percentile (0-100),
+// interpolating between values if need be. eg AggPercentile(50) is the median.
+func AggPercentile(p float64) AggOp {
+	return AggOp{kind: aggPercentile, p: p}
+}
+
+func (op AggOp) String() string {
+	switch op.kind {
+	case aggCount:
+		return "count"
+	case aggMin:
+		return "min"
+	case aggMax:
+		return "max"
+	case aggSum:
+		return "sum"
+	case aggMean:
+		return "mean"
+	case aggPercentile:
+		return fmt.Sprintf("p%g", op.p)
+	}
+	return "?"
+}
+
+// numericValues collects the values of a numeric field over a set of docs.
+// For slices, each element is a separate value.
+func (coll *Collection) numericValues(ids docSet, field string) ([]float64, error) {
+	fp, err := coll.queryField(field)
+	if err != nil {
+		return nil, err
+	}
+	if !numericKind(baseType(fp.Type).Kind()) {
+		return nil, fmt.Errorf("%w '%s' (%s isn't numeric)", ErrUnsupportedField, field, fp.Type)
+	}
+	vals := make([]float64, 0, len(ids))
+	for id, _ := range ids {
+		for _, val := range fp.docStrings(coll.docs[id]) {
+			v, _ := strconv.ParseFloat(val, 64)
+			vals = append(vals, v)
+		}
+	}
+	return vals, nil
+}
+
+// Aggregate calculates statistics for a numeric field over the docs
+// matching a query. The results are returned in the same order as ops.
+// If no docs match, min, max, mean and percentiles are NaN.
+func (coll *Collection) Aggregate(q Query, field string, ops ...AggOp) ([]float64, error) {
+	for _, op := range ops {
+		if op.kind == aggPercentile && (op.p < 0 || op.p > 100 || math.IsNaN(op.p)) {
+			return nil, fmt.Errorf("bad percentile (%g)", op.p)
+		}
+	}
+
+	coll.RLock()
+	defer coll.RUnlock()
+	ids, err := coll.perform(q)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := coll.numericValues(ids, field)
+	if err != nil {
+		return nil, err
+	}
+	sort.Float64s(vals)
+
+	sum := 0.0
+	for _, v := range vals {
+		sum += v
+	}
+	n := len(vals)
+	out := make([]float64, len(ops))
+	for i, op := range ops {
+		if n == 0 && op.kind != aggCount && op.kind != aggSum {
+			out[i] = math.NaN()
+			continue
+		}
+		switch op.kind {
+		case aggCount:
+			out[i] = float64(n)
+		case aggMin:
+			out[i] = vals[0]
+		case aggMax:
+			out[i] = vals[n-1]
+		case aggSum:
+			out[i] = sum
+		case aggMean:
+			out[i] = sum / float64(n)
+		case aggPercentile:
+			out[i] = percentile(vals, op.p)
+		}
+	}
+	return out, nil
+}
+
+// percentile returns the pth percentile of sorted (non-empty) vals
+func percentile(vals []float64, p float64) float64 {
+	rank := p / 100 * float64(len(vals)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return vals[lo] + (vals[hi]-vals[lo])*(rank-float64(lo))
+}
+
+// NumericBucket is a single bucket in a numeric histogram, holding the
+// docs with values in the range [Low, Low+interval)
+type NumericBucket struct {
+	Low   float64
+	Count int
+}
+
+// NumericHistogram counts the docs matching a query by the value of a
+// numeric field, in buckets of size interval (aligned to multiples of
+// interval).
+// Buckets are returned in order, including any empty buckets in between.
+// Returns ErrTooManyBuckets if that would be an unreasonable number of
+// buckets.
+func (coll *Collection) NumericHistogram(q Query, field string, interval float64) ([]NumericBucket, error) {
+	if !(interval > 0) || math.IsInf(interval, 0) {
+		return nil, fmt.Errorf("bad histogram interval (%g)", interval)
+	}
+
+	coll.RLock()
+	defer coll.RUnlock()
+	ids, err := coll.perform(q)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := coll.numericValues(ids, field)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []NumericBucket{}
+	if len(vals) == 0 {
+		return buckets, nil
+	}
+	sort.Float64s(vals)
+	first := math.Floor(vals[0] / interval)
+	last := math.Floor(vals[len(vals)-1] / interval)
+	// (checked as a float, as it could overflow an int)
+	if span := last - first + 1; !(span <= maxHistogramBuckets) {
+		return nil, fmt.Errorf("%w (%g)", ErrTooManyBuckets, span)
+	}
+	n := int(last-first) + 1
+	for i := 0; i < n; i++ {
+		buckets = append(buckets, NumericBucket{Low: (first + float64(i)) * interval})
+	}
+	for _, v := range vals {
+		buckets[int(math.Floor(v/interval)-first)].Count++
+	}
+	return buckets, nil
+}
@@ -0,0 +1,152 @@
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDateHistogram(t *testing.T) {
+	coll := NewCollection(&EventDoc{})
+	for _, date := range []string{
+		"2010-06-14T10:20", "2010-06-14", "2010-06-16", "2010-06-21",
+		"2010-08-01", "2011-01-01", "T11:52", "", "2010-13-45",
+	} {
+		coll.Put(&EventDoc{Date: date})
+	}
+
+	// expect gives the leading buckets, n the total number of buckets
+	tests := []struct {
+		interval DateInterval
+		n        int
+		expect   []string
+	}{
+		{Day, 202, []string{"2010-06-14:2", "2010-06-15:0", "2010-06-16:1"}},
+		{Week, 29, []string{"2010-06-14:3", "2010-06-21:1", "2010-06-28:0"}},
+		{Month, 8, []string{"2010-06-01:4", "2010-07-01:0", "2010-08-01:1", "2010-09-01:0",
+			"2010-10-01:0", "2010-11-01:0", "2010-12-01:0", "2011-01-01:1"}},
+		{Year, 2, []string{"2010-01-01:5", "2011-01-01:1"}},
+	}
+	for _, test := range tests {
+		buckets, err := coll.DateHistogram(NewAllQuery(), "date", test.interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, b := range buckets {
+			got = append(got, fmt.Sprintf("%s:%d", b.Start.Format("2006-01-02"), b.Count))
+		}
+		if len(got) != test.n {
+			t.Errorf("interval %d: got %d buckets, expected %d", test.interval, len(got), test.n)
+			continue
+		}
+		got = got[:len(test.expect)]
+		if strings.Join(got, ",") != strings.Join(test.expect, ",") {
+			t.Errorf("interval %d: got %v, expected %v", test.interval, got, test.expect)
+		}
+	}
+
+	buckets, err := coll.DateHistogram(NewContainsQuery("date", "2011"), "date", Month)
+	if err != nil || len(buckets) != 1 || buckets[0].Count != 1 {
+		t.Errorf("histogram over query failed: %v %v", buckets, err)
+	}
+	buckets, err = coll.DateHistogram(NewNilQuery(), "date", Month)
+	if err != nil || len(buckets) != 0 {
+		t.Errorf("empty histogram failed: %v %v", buckets, err)
+	}
+
+	// a stray date way out of range
+	coll.Put(&EventDoc{Date: "0001-01-01"})
+	if _, err := coll.DateHistogram(NewAllQuery(), "date", Day); !errors.Is(err, ErrTooManyBuckets) {
+		t.Errorf("expected ErrTooManyBuckets, got %v", err)
+	}
+	buckets, err = coll.DateHistogram(NewAllQuery(), "date", Year)
+	if err != nil || len(buckets) != 2011 {
+		t.Errorf("expected 2011 year buckets, got %d (%v)", len(buckets), err)
+	}
+
+	// spans too long for a time.Duration
+	coll = NewCollection(&EventDoc{})
+	coll.Put(&EventDoc{Date: "1700-01-04"})
+	coll.Put(&EventDoc{Date: "2020-01-06"})
+	buckets, err = coll.DateHistogram(NewAllQuery(), "date", Week)
+	if err != nil || len(buckets) != 16698 {
+		t.Fatalf("expected 16698 week buckets, got %d (%v)", len(buckets), err)
+	}
+	if start := buckets[len(buckets)-1].Start.Format("2006-01-02"); start != "2020-01-06" || buckets[len(buckets)-1].Count != 1 {
+		t.Errorf("last week bucket: got %s:%d, expected 2020-01-06:1", start, buckets[len(buckets)-1].Count)
+	}
+	if _, err := coll.DateHistogram(NewAllQuery(), "date", Day); !errors.Is(err, ErrTooManyBuckets) || !strings.Contains(err.Error(), "(116880)") {
+		t.Errorf("expected ErrTooManyBuckets (116880), got %v", err)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	coll := NewCollection(&EventDoc{})
+	for _, n := range []int{7, -3, 10, 1, 5} {
+		coll.Put(&EventDoc{Name: "event", Count: n})
+	}
+	coll.Put(&EventDoc{Name: "other", Count: 100})
+
+	ops := []AggOp{AggCount, AggMin, AggMax, AggSum, AggMean, AggPercentile(50), AggPercentile(25), AggPercentile(100)}
+	got, err := coll.Aggregate(NewExactQuery("name", "event"), "count", ops...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []float64{5, -3, 10, 20, 4, 5, 1, 10}
+	for i, op := range ops {
+		if got[i] != expect[i] {
+			t.Errorf("%s: got %g, expected %g", op, got[i], expect[i])
+		}
+	}
+
+	got, _ = coll.Aggregate(NewAllQuery(), "count", AggPercentile(90))
+	if got[0] != 55 {
+		t.Errorf("p90: got %g, expected 55", got[0])
+	}
+
+	got, err = coll.Aggregate(NewNilQuery(), "count", AggCount, AggSum, AggMean)
+	if err != nil || got[0] != 0 || got[1] != 0 || !math.IsNaN(got[2]) {
+		t.Errorf("empty aggregate failed: %v %v", got, err)
+	}
+
+	if _, err := coll.Aggregate(NewAllQuery(), "name", AggSum); !errors.Is(err, ErrUnsupportedField) {
+		t.Errorf("expected ErrUnsupportedField, got %v", err)
+	}
+	if _, err := coll.Aggregate(NewAllQuery(), "count", AggPercentile(101)); err == nil {
+		t.Errorf("expected error for bad percentile")
+	}
+}
+
+func TestNumericHistogram(t *testing.T) {
+	coll := NewCollection(&EventDoc{})
+	for _, n := range []int{-3, 1, 5, 7, 10, 34} {
+		coll.Put(&EventDoc{Count: n})
+	}
+	buckets, err := coll.NumericHistogram(NewAllQuery(), "count", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprintf("%v", buckets)
+	expect := "[{-10 1} {0 3} {10 1} {20 0} {30 1}]"
+	if got != expect {
+		t.Errorf("got %s, expected %s", got, expect)
+	}
+	if _, err := coll.NumericHistogram(NewAllQuery(), "count", 0); err == nil {
+		t.Errorf("expected error for zero interval")
+	}
+
+	// huge values (beyond float64 integer precision)
+	coll = NewCollection(&EventDoc{})
+	coll.Put(&EventDoc{Count: 1 << 60})
+	buckets, err = coll.NumericHistogram(NewAllQuery(), "count", 1)
+	if err != nil || len(buckets) != 1 || buckets[0].Count != 1 {
+		t.Errorf("huge value: got %v (%v)", buckets, err)
+	}
+	coll.Put(&EventDoc{Count: 0})
+	if _, err := coll.NumericHistogram(NewAllQuery(), "count", 1); !errors.Is(err, ErrTooManyBuckets) {
+		t.Errorf("expected ErrTooManyBuckets, got %v", err)
+	}
+}
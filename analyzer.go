@@ -0,0 +1,150 @@
+package badger
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Token is a single term produced by an Analyzer
+type Token struct {
+	Term string
+	// Pos is the position of the token within the text. Usually it just
+	// goes up by one for each token, but analyzers can leave gaps (eg for
+	// words they've dropped) or put more than one token at a position.
+	Pos int
+}
+
+// Analyzer breaks text up into tokens, for whole-word matching and
+// indexing. Tokens must be returned in position order.
+// The same analyzer is applied to the text being searched for, so
+// they'll match up.
+type Analyzer interface {
+	Analyze(text string) []Token
+}
+
+// AnalyzerFunc lets a plain function be used as an Analyzer
+type AnalyzerFunc func(text string) []Token
+
+func (fn AnalyzerFunc) Analyze(text string) []Token {
+	return fn(text)
+}
+
+// StandardAnalyzer is the default analyzer. It lowercases the text,
+// splits it on whitespace and strips out punctuation (see Tokenise).
+var StandardAnalyzer Analyzer = AnalyzerFunc(func(text string) []Token {
+	terms := Tokenise(text)
+	toks := make([]Token, len(terms))
+	for i, term := range terms {
+		toks[i] = Token{term, i}
+	}
+	return toks
+})
+
+// registered analyzers, for use by name (eg in struct tags)
+var analyzers = struct {
+	sync.RWMutex
+	byName map[string]Analyzer
+}{
+	byName: map[string]Analyzer{
+		"standard": StandardAnalyzer,
+		"english":  EnglishAnalyzer,
+		"cjk":      CJKAnalyzer,
+	},
+}
+
+// RegisterAnalyzer makes an analyzer available by name, so it can be
+// chosen in struct tags (eg `badger:",analyzer=mine"`).
+// Analyzers need to be registered before any collections which use them
+// are created.
+func RegisterAnalyzer(name string, a Analyzer) {
+	analyzers.Lock()
+	defer analyzers.Unlock()
+	analyzers.byName[name] = a
+}
+
+// lookupAnalyzer returns the registered analyzer called name
+func lookupAnalyzer(name string) (Analyzer, bool) {
+	analyzers.RLock()
+	defer analyzers.RUnlock()
+	a, got := analyzers.byName[name]
+	return a, got
+}
+
+// SetFieldAnalyzer sets the analyzer used to tokenise a field for
+// whole-word matching (and scoring). Any index on the field is rebuilt.
+// Analyzers aren't saved in snapshots, so need setting again after Load
+// (unless they're set by struct tags).
+func (coll *Collection) SetFieldAnalyzer(fieldName string, a Analyzer) {
+	coll.Lock()
+	defer coll.Unlock()
+	field := strings.ToLower(fieldName)
+	coll.fieldAnalyzers[field] = a
+	if idx, got := coll.wordIndexes[field]; got {
+		idx = newWordIndex(idx.field, coll.analyzer(field))
+		for id, doc := range coll.docs {
+			idx.add(id, doc)
+		}
+		coll.wordIndexes[field] = idx
+	}
+}
+
+// analyzer returns the analyzer for a field (folding diacritics first,
+// if the collection is set to)
+func (coll *Collection) analyzer(field string) Analyzer {
+	a, got := coll.fieldAnalyzers[strings.ToLower(field)]
+	if !got {
+		a = StandardAnalyzer
+	}
+	if coll.fold {
+		a = NewFoldingAnalyzer(a)
+	}
+	return a
+}
+
+// termsOf returns just the terms from a list of tokens
+func termsOf(toks []Token) []string {
+	out := make([]string, len(toks))
+	for i, tok := range toks {
+		out[i] = tok.Term
+	}
+	return out
+}
+
+// phraseMatch returns true if the phrase occurs in the text tokens, ie
+// the terms appear at the same positions relative to each other.
+// An empty phrase matches anything.
+func phraseMatch(text []Token, phrase []Token) bool {
+	if len(phrase) == 0 {
+		return true
+	}
+	for _, start := range text {
+		if start.Term != phrase[0].Term {
+			continue
+		}
+		t := 1
+		for ; t < len(phrase); t++ {
+			if !termAt(text, phrase[t].Term, start.Pos+phrase[t].Pos-phrase[0].Pos) {
+				break
+			}
+		}
+		if t == len(phrase) {
+			// got a full match!
+			return true
+		}
+	}
+	return false
+}
+
+// termAt returns true if term occurs at position pos in the text tokens
+func termAt(text []Token, term string, pos int) bool {
+	i := sort.Search(len(text), func(i int) bool {
+		return text[i].Pos >= pos
+	})
+	for ; i < len(text) && text[i].Pos == pos; i++ {
+		if text[i].Term == term {
+			return true
+		}
+	}
+	return false
+}
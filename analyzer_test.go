@@ -0,0 +1,57 @@
+package badger
+
+import (
+	"strings"
+	"testing"
+)
+
+// splits on commas, and drops "the" (leaving a gap in the positions)
+var commaAnalyzer = AnalyzerFunc(func(text string) []Token {
+	toks := []Token{}
+	for i, part := range strings.Split(strings.ToLower(text), ",") {
+		part = strings.TrimSpace(part)
+		if part != "the" {
+			toks = append(toks, Token{part, i})
+		}
+	}
+	return toks
+})
+
+type RecipeDoc struct {
+	Name        string
+	Ingredients string `badger:",wholeword,analyzer=comma"`
+}
+
+func init() {
+	RegisterAnalyzer("comma", commaAnalyzer)
+}
+
+func TestAnalyzer(t *testing.T) {
+	coll := NewCollection(&RecipeDoc{})
+	coll.SetWholeWordField("name")
+	coll.Put(&RecipeDoc{"Lemon Curd", "lemon juice, sugar, butter, eggs"})
+	coll.Put(&RecipeDoc{"Cheese on Toast", "bread, cheese, the, butter"})
+	coll.Put(&RecipeDoc{"Toast", "bread, butter"})
+
+	tests := []queryTest{
+		{NewContainsQuery("ingredients", "lemon juice"), "Lemon Curd"},
+		{NewContainsQuery("ingredients", "lemon"), ""},
+		{NewContainsQuery("ingredients", "sugar,butter"), "Lemon Curd"},
+		{NewContainsQuery("ingredients", "bread,butter"), "Toast"},
+		// the gap left by "the" has to line up
+		{NewContainsQuery("ingredients", "cheese,the,butter"), "Cheese on Toast"},
+		{NewContainsQuery("ingredients", "cheese,butter"), ""},
+		{NewContainsQuery("ingredients", "cheese,x,butter"), ""},
+		{NewContainsQuery("name", "toast"), "Cheese on Toast,Toast"},
+	}
+	assertQueries(t, "tag", coll, "name", tests)
+
+	// swap the analyzers over
+	coll.SetFieldAnalyzer("name", commaAnalyzer)
+	coll.SetFieldAnalyzer("ingredients", StandardAnalyzer)
+	assertQueries(t, "SetFieldAnalyzer", coll, "name", []queryTest{
+		{NewContainsQuery("ingredients", "lemon"), "Lemon Curd"},
+		{NewContainsQuery("ingredients", "butter eggs"), "Lemon Curd"},
+		{NewContainsQuery("name", "toast"), "Toast"},
+	})
+}
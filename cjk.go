@@ -0,0 +1,62 @@
+package badger
+
+import (
+	"strings"
+	"unicode"
+)
+
+// CJKAnalyzer is like the StandardAnalyzer, but also copes with Chinese,
+// Japanese and Korean text, which doesn't (always) put spaces between
+// words. Runs of CJK characters are split into overlapping bigrams (eg
+// "東京都" => "東京" "京都"), which is crude but lets searches match
+// words without needing a dictionary. A lone CJK character is kept as a
+// token on it's own (but won't match inside a longer run).
+// Any other text is treated just as StandardAnalyzer treats it, so it's
+// fine for mixed text (eg "東京tower" => "東京" "tower").
+// It's registered as "cjk".
+var CJKAnalyzer Analyzer = AnalyzerFunc(func(text string) []Token {
+	toks := []Token{}
+	pos := 0
+	emit := func(term string) {
+		toks = append(toks, Token{term, pos})
+		pos++
+	}
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		if strings.IndexFunc(word, isCJK) == -1 {
+			// same as Tokenise
+			emit(stripPunc(word))
+			continue
+		}
+		runes := []rune(word)
+		for i := 0; i < len(runes); {
+			j := i + 1
+			if isCJK(runes[i]) {
+				for j < len(runes) && isCJK(runes[j]) {
+					j++
+				}
+				if j-i == 1 {
+					emit(string(runes[i]))
+				}
+				for k := i; k+1 < j; k++ {
+					emit(string(runes[k : k+2]))
+				}
+			} else {
+				// (punctuation splits CJK runs, but is otherwise stripped)
+				for j < len(runes) && !isCJK(runes[j]) {
+					j++
+				}
+				if term := stripPunc(string(runes[i:j])); term != "" {
+					emit(term)
+				}
+			}
+			i = j
+		}
+	}
+	return toks
+})
+
+// isCJK returns true for Chinese, Japanese and Korean characters
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		r == 'ー' // katakana-hiragana prolonged sound mark
+}
@@ -0,0 +1,62 @@
+package badger
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCJKAnalyzer(t *testing.T) {
+	for _, test := range []struct {
+		in     string
+		expect string
+	}{
+		{"Hello, there!", "hello@0 there@1"},
+		{"東京都", "東京@0 京都@1"},
+		{"東京タワー", "東京@0 京タ@1 タワ@2 ワー@3"},
+		{"東京、大阪", "東京@0 大阪@1"},
+		{"東京tower 2020年", "東京@0 tower@1 2020@2 年@3"},
+		{"서울 특별시", "서울@0 특별@1 별시@2"},
+		{"猫", "猫@0"},
+	} {
+		parts := []string{}
+		for _, tok := range CJKAnalyzer.Analyze(test.in) {
+			parts = append(parts, fmt.Sprintf("%s@%d", tok.Term, tok.Pos))
+		}
+		if got := strings.Join(parts, " "); got != test.expect {
+			t.Errorf("Analyze(%q): got %q, expected %q", test.in, got, test.expect)
+		}
+	}
+}
+
+type CityDoc struct {
+	Name string `badger:",wholeword,analyzer=cjk"`
+}
+
+func TestCJKSearch(t *testing.T) {
+	coll := NewCollection(&CityDoc{})
+	coll.Put(&CityDoc{"東京都庁"})
+	coll.Put(&CityDoc{"京都タワー"})
+	coll.Put(&CityDoc{"Tokyo Tower (東京タワー)"})
+
+	tests := []queryTest{}
+	for _, test := range []struct {
+		q      string
+		expect string
+	}{
+		{"東京", "Tokyo Tower (東京タワー),東京都庁"},
+		{"京都", "京都タワー,東京都庁"},
+		{"京都タワー", "京都タワー"},
+		{"タワー", "Tokyo Tower (東京タワー),京都タワー"},
+		{"都庁", "東京都庁"},
+		{"東京タワ", "Tokyo Tower (東京タワー)"},
+		{"京タワー", "Tokyo Tower (東京タワー)"},
+		{"都タワー", "京都タワー"},
+		{"大阪", ""},
+		{"tower", "Tokyo Tower (東京タワー)"},
+		{"tokyo tower 東京", "Tokyo Tower (東京タワー)"},
+	} {
+		tests = append(tests, queryTest{NewContainsQuery("name", test.q), test.expect})
+	}
+	assertQueries(t, "cjk", coll, "name", tests)
+}
@@ -1,17 +1,41 @@
 package badger
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
-	"strconv"
 	"strings"
 	"sync"
 )
 
+var (
+	// ErrUnknownField is returned for queries upon fields which don't exist
+	ErrUnknownField = errors.New("unknown field")
+	// ErrUnsupportedField is returned for queries upon fields of a type
+	// which can't be queried
+	ErrUnsupportedField = errors.New("can't query field")
+	// ErrTypeMismatch is returned when a doc is the wrong type for the collection
+	ErrTypeMismatch = errors.New("doc type mismatch")
+	// ErrBadResult is returned when Find is given something other than a
+	// pointer to a slice of pointers to hold the results
+	ErrBadResult = errors.New("bad result argument")
+	// ErrBadCursor is returned when FindOptions.After isn't a valid cursor
+	ErrBadCursor = errors.New("bad cursor")
+	// ErrTooManyBuckets is returned when a histogram would need more than
+	// maxHistogramBuckets buckets
+	ErrTooManyBuckets = errors.New("too many histogram buckets")
+	// ErrLogSync is returned when a change has been made and written to
+	// the write-ahead log, but the log couldn't be synced to disk, so the
+	// change might not survive a crash. No more changes are accepted
+	// until the log is compacted.
+	ErrLogSync = errors.New("write-ahead log sync failed")
+)
+
 // Collection holds a set of documents, all of the same type.
 // Caveats:
 // - have to store ptrs to structs
-// - can only query on string and []string fields (but can store anything)
+// - can only query on string, numeric, bool and time fields, or slices
+//   of them (but can store anything)
 //
 type Collection struct {
 	sync.RWMutex
@@ -20,6 +44,30 @@ type Collection struct {
 	DefaultField    string // field to search by default (mainly for the benefit of the query parser)
 	dirty           bool
 	wholeWordFields map[string]struct{}
+	// scoring weights for fields, keyed by lowercase field name
+	fieldBoosts map[string]float64
+	// analyzers for whole-word fields, keyed by lowercase field name
+	fieldAnalyzers map[string]Analyzer
+	// fold diacritics when matching (see SetFolding)
+	fold bool
+	// synonyms by lowercase field name ("" for the whole collection)
+	synonyms map[string]Synonyms
+	// inverted indexes for the whole-word fields, keyed by lowercase field name
+	wordIndexes map[string]*wordIndex
+	// indexes added with AddIndex, keyed by lowercase field name
+	rangeIndexes map[string]*rangeIndex
+	exactIndexes map[string]*exactIndex
+	// maps primary keys to docs (nil if docs are keyed by address)
+	primary *keyIndex
+	// the order docs were added in, used to break ties when sorting (so
+	// cursors don't need to give away addresses)
+	seqs    map[uintptr]uint64
+	nextSeq uint64
+	// write-ahead log, for collections opened with OpenLogged
+	wal *writeAheadLog
+	// the fields of docType, worked out up front (see buildSchema)
+	schema map[string]*fieldPath
+	fields []FieldInfo
 }
 
 // NewCollection initialises a collection for holding documents of
@@ -30,6 +78,13 @@ func NewCollection(referenceDoc interface{}) *Collection {
 	coll := &Collection{
 		docs:            make(map[uintptr]interface{}),
 		wholeWordFields: make(map[string]struct{}),
+		fieldBoosts:     make(map[string]float64),
+		fieldAnalyzers:  make(map[string]Analyzer),
+		synonyms:        make(map[string]Synonyms),
+		wordIndexes:     make(map[string]*wordIndex),
+		rangeIndexes:    make(map[string]*rangeIndex),
+		exactIndexes:    make(map[string]*exactIndex),
+		seqs:            make(map[uintptr]uint64),
 		docType:         reflect.TypeOf(referenceDoc),
 	}
 
@@ -40,12 +95,57 @@ func NewCollection(referenceDoc interface{}) *Collection {
 		panic("doctype must be ptr to struct")
 	}
 
+	// work out the fields once, rather than on every query
+	coll.schema = buildSchema(coll.docType.Elem())
+	coll.fields = validFields(coll.docType.Elem())
+
+	// set up any fields configured by struct tags
+	coll.applyTags(coll.docType.Elem(), "", map[reflect.Type]struct{}{})
+	return coll
+}
+
+// NewCollectionWithKey initialises a collection where docs are identified
+// by the value in keyField (which must be a string or int field), rather than
+// by their address in memory.
+// Putting a doc replaces any existing doc with the same key, and docs can be
+// retrieved by key with Get.
+func NewCollectionWithKey(referenceDoc interface{}, keyField string) *Collection {
+	coll := NewCollection(referenceDoc)
+	fp, ok := coll.resolveField(keyField)
+	if !ok {
+		panic("couldn't resolve key field " + keyField)
+	}
+	k := fp.Type.Kind()
+	if k != reflect.String && k != reflect.Int {
+		panic("key field must be string or int")
+	}
+	if !fp.direct {
+		panic("key field must be a top-level field")
+	}
+	coll.primary = newKeyIndex(fp)
 	return coll
 }
 
 //Cheesy-as-hell hack to force a field to require whole-word-matching. Temporary.
+// Whole-word fields are indexed, so searching them doesn't require a full scan.
 func (coll *Collection) SetWholeWordField(fieldName string) {
-	coll.wholeWordFields[strings.ToLower(fieldName)] = struct{}{}
+	coll.Lock()
+	defer coll.Unlock()
+	field := strings.ToLower(fieldName)
+	coll.wholeWordFields[field] = struct{}{}
+	if _, got := coll.wordIndexes[field]; got {
+		return
+	}
+	fp, ok := coll.resolveField(field)
+	if !ok || fp.noQuery || !queryableType(fp.Type) {
+		// leave it to find() to complain at query time
+		return
+	}
+	idx := newWordIndex(fp, coll.analyzer(field))
+	for id, doc := range coll.docs {
+		idx.add(id, doc)
+	}
+	coll.wordIndexes[field] = idx
 }
 
 func (coll *Collection) Count() int {
@@ -54,70 +154,220 @@ func (coll *Collection) Count() int {
 	return len(coll.docs)
 }
 
-// ValidField returns a list of valid field names
+// FieldInfo describes a field in the doc struct
+type FieldInfo struct {
+	Name string
+	Type reflect.Type
+	// Queryable is set if the field can be used in queries
+	Queryable bool
+	// set if tagged noquery
+	noQuery bool
+}
+
+// ValidField returns a list of valid field names.
+// Fields tagged as noquery or hidden are left out.
 func (coll *Collection) ValidFields() []string {
-	coll.RLock()
-	defer coll.RUnlock()
-	return validFields(coll.docType.Elem())
+	names := []string{}
+	for _, fi := range coll.Fields() {
+		if !fi.noQuery {
+			names = append(names, fi.Name)
+		}
+	}
+	return names
+}
+
+// Fields is like ValidFields, but also reports the type of each field.
+// It includes fields tagged noquery (but not hidden ones).
+func (coll *Collection) Fields() []FieldInfo {
+	return append([]FieldInfo{}, coll.fields...)
 }
 
-// TODO: update to:
-// 1) handler pointer members
-// 2) filter out unwanted members (eg functions)
-func validFields(typ reflect.Type) []string {
-	fields := []string{}
+// validFields lists the fields in struct type typ. Nested structs
+// (including pointers to structs and slices of structs) are listed as
+// dotted paths, and embedded structs are flattened.
+// Names are taken from badger struct tags, if set.
+// TODO: filter out unwanted members (eg functions)
+func validFields(typ reflect.Type) []FieldInfo {
+	return structFields(typ, map[reflect.Type]struct{}{})
+}
+
+// structFields does the work for validFields. seen holds the structs
+// already being listed, to avoid looping forever on recursive types.
+func structFields(typ reflect.Type, seen map[reflect.Type]struct{}) []FieldInfo {
+	seen[typ] = struct{}{}
+	defer delete(seen, typ)
+	fields := []FieldInfo{}
 	for i := 0; i < typ.NumField(); i++ {
 		sf := typ.Field(i)
-		if sf.Type.Kind() == reflect.Struct {
-			childFields := validFields(sf.Type)
-			if !sf.Anonymous {
-				for j, _ := range childFields {
-					childFields[j] = sf.Name + "." + childFields[j]
+		tag := parseTag(sf)
+		if tag.ignore || tag.hidden {
+			continue
+		}
+		if st := structType(sf.Type); st != nil {
+			if _, got := seen[st]; got {
+				continue
+			}
+			childFields := structFields(st, seen)
+			for j, _ := range childFields {
+				if !tag.promoted(sf) {
+					childFields[j].Name = tag.queryName(sf) + "." + childFields[j].Name
+				}
+				if tag.noQuery {
+					childFields[j].Queryable = false
+					childFields[j].noQuery = true
 				}
 			}
 			fields = append(fields, childFields...)
 		} else {
-			fields = append(fields, sf.Name)
+			queryable := queryableType(sf.Type) && !tag.noQuery
+			fields = append(fields, FieldInfo{tag.queryName(sf), sf.Type, queryable, tag.noQuery})
 		}
 	}
 	return fields
 }
 
+// Put adds a doc to the collection.
+// For collections with a primary key, any existing doc with the same key
+// is replaced.
+// Panics upon error (see PutErr).
 func (coll *Collection) Put(doc interface{}) {
-	t := reflect.TypeOf(doc)
-	if t != coll.docType {
-		panic(fmt.Sprintf("doc type mismatch (got %s, expecting %s)", t, coll.docType))
+	if err := coll.PutErr(doc); err != nil {
+		panic(err.Error())
+	}
+}
+
+// PutErr is the same as Put, but returns an error instead of panicking
+// (eg if doc is the wrong type, or the write-ahead log fails).
+// If the error is ErrLogSync, the doc has been added (see ErrLogSync),
+// otherwise the collection is left unchanged.
+func (coll *Collection) PutErr(doc interface{}) error {
+	if err := coll.checkType(doc); err != nil {
+		return err
 	}
-	key := reflect.ValueOf(doc).Pointer()
+	id := reflect.ValueOf(doc).Pointer()
 
 	coll.Lock()
 	defer coll.Unlock()
 
-	coll.docs[key] = doc
+	// any existing doc with the same key gets replaced
+	var replaced []uintptr
+	if coll.primary != nil {
+		if other, got := coll.primary.lookup(coll.primary.key(doc)); got && other != id {
+			replaced = append(replaced, other)
+		}
+	}
+
+	// log it before changing anything, so a failure leaves the collection
+	// as it was
+	if coll.wal != nil {
+		if err := coll.wal.put(id, doc, replaced); err != nil {
+			return fmt.Errorf("write-ahead log failed: %w", err)
+		}
+	}
+
+	for _, other := range replaced {
+		coll.unindexDoc(other)
+		delete(coll.docs, other)
+		delete(coll.seqs, other)
+	}
+
+	if _, got := coll.docs[id]; got {
+		// already got it, but it might have changed since
+		coll.unindexDoc(id)
+	} else {
+		coll.seqs[id] = coll.nextSeq
+		coll.nextSeq++
+	}
+	coll.docs[id] = doc
+	coll.indexDoc(id, doc)
 	coll.dirty = true
+
+	// it's in the log, so it's applied even if the sync fails
+	if coll.wal != nil {
+		return coll.wal.commit()
+	}
+	return nil
 }
 
+// Remove removes a doc from the collection.
+// For collections with a primary key, doc can be any doc with the same
+// key, rather than the one actually stored.
+// Panics upon error (see RemoveErr).
 func (coll *Collection) Remove(doc interface{}) {
-	t := reflect.TypeOf(doc)
-	if t != coll.docType {
-		panic(fmt.Sprintf("doc type mismatch (got %s, expecting %s)", t, coll.docType))
+	if err := coll.RemoveErr(doc); err != nil {
+		panic(err.Error())
 	}
-	key := reflect.ValueOf(doc).Pointer()
+}
+
+// RemoveErr is the same as Remove, but returns an error instead of
+// panicking.
+// As with PutErr, the doc has been removed if the error is ErrLogSync,
+// otherwise the collection is left unchanged.
+func (coll *Collection) RemoveErr(doc interface{}) error {
+	if err := coll.checkType(doc); err != nil {
+		return err
+	}
+	id := reflect.ValueOf(doc).Pointer()
 
 	coll.Lock()
 	defer coll.Unlock()
 
-	delete(coll.docs, key)
-	coll.dirty = true
+	if _, got := coll.docs[id]; !got && coll.primary != nil {
+		id, got = coll.primary.lookup(coll.primary.key(doc))
+		if !got {
+			return nil
+		}
+	}
+	if _, got := coll.docs[id]; got {
+		if err := coll.removeDoc(id); err != nil {
+			return err
+		}
+		coll.dirty = true
+		if coll.wal != nil {
+			return coll.wal.commit()
+		}
+	}
+	return nil
+}
+
+// checkType makes sure doc is the right type for the collection
+func (coll *Collection) checkType(doc interface{}) error {
+	t := reflect.TypeOf(doc)
+	if t != coll.docType {
+		return fmt.Errorf("%w (got %s, expecting %s)", ErrTypeMismatch, t, coll.docType)
+	}
+	return nil
+}
+
+// removeDoc logs and performs the removal of a doc.
+// The caller must hold the collection lock, and commit the log afterward.
+func (coll *Collection) removeDoc(id uintptr) error {
+	if coll.wal != nil {
+		if err := coll.wal.remove(id); err != nil {
+			return fmt.Errorf("write-ahead log failed: %w", err)
+		}
+	}
+	coll.unindexDoc(id)
+	delete(coll.docs, id)
+	delete(coll.seqs, id)
+	return nil
 }
 
-/*
-func (coll *Collection) Get(id string) interface{} {
+// Get returns the doc with the given primary key, or nil if there isn't one.
+// Only works for collections created with NewCollectionWithKey.
+// Integer keys should be passed in as decimal strings.
+func (coll *Collection) Get(key string) interface{} {
 	coll.RLock()
 	defer coll.RUnlock()
+	if coll.primary == nil {
+		panic("collection has no primary key")
+	}
+	id, got := coll.primary.lookup(key)
+	if !got {
+		return nil
+	}
 	return coll.docs[id]
 }
-*/
 
 func (coll *Collection) findAll() docSet {
 	matching := docSet{}
@@ -127,57 +377,66 @@ func (coll *Collection) findAll() docSet {
 	return matching
 }
 
-func (coll *Collection) find(field string, cmp func(string) bool) docSet {
-	// resolve the field
+// resolveField looks up a field in the doc struct (case-insensitively).
+// The field can be a dotted path into nested structs (eg "details.name").
+func (coll *Collection) resolveField(field string) (*fieldPath, bool) {
+	if fp, got := coll.schema[strings.ToLower(field)]; got {
+		return fp, true
+	}
+	// not a field we know of (or deeper into a recursive type than
+	// buildSchema goes)
+	return resolvePath(coll.docType.Elem(), field)
+}
+
+// queryField resolves a field, and checks that it can be queried
+func (coll *Collection) queryField(field string) (*fieldPath, error) {
 	field = strings.ToLower(field)
 
-	sf, ok := coll.docType.Elem().FieldByNameFunc(func(name string) bool {
-		return strings.ToLower(name) == field
-	})
+	fp, ok := coll.resolveField(field)
 	if !ok {
-		panic("couldn't resolve field " + field)
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownField, field)
+	}
+	if fp.noQuery {
+		return nil, fmt.Errorf("%w '%s' (not queryable)", ErrUnsupportedField, field)
+	}
+	if !queryableType(fp.Type) {
+		return nil, fmt.Errorf("%w '%s' (%s)", ErrUnsupportedField, field, fp.Type)
+	}
+	return fp, nil
+}
+
+func (coll *Collection) find(field string, cmp func(string) bool) (docSet, error) {
+	// resolve the field
+	fp, err := coll.queryField(field)
+	if err != nil {
+		return nil, err
 	}
 
 	matching := docSet{}
 
-	//
-	switch sf.Type.Kind() {
-	case reflect.Int:
-		//
+	if fp.direct && fp.Type.Kind() == reflect.String {
+		// the common case - a plain string field
 		for id, doc := range coll.docs {
 			s := reflect.ValueOf(doc).Elem() // get struct
-			f := s.FieldByIndex(sf.Index)
-			val := strconv.FormatInt(f.Int(), 10)
-			if cmp(val) {
-				matching[id] = struct{}{}
-			}
-		}
-	case reflect.String:
-		//
-		for id, doc := range coll.docs {
-			s := reflect.ValueOf(doc).Elem() // get struct
-			f := s.FieldByIndex(sf.Index)
+			f := s.Field(fp.steps[0][0])
 			if cmp(f.String()) {
 				matching[id] = struct{}{}
 			}
 		}
-	case reflect.Slice:
-		// it's []string
-		for id, doc := range coll.docs {
-			s := reflect.ValueOf(doc).Elem() // get struct
-			f := s.FieldByIndex(sf.Index)    // get slice
-			// check each item in the slice
-			for idx := 0; idx < f.Len(); idx++ {
-				if cmp(f.Index(idx).String()) {
-					matching[id] = struct{}{}
-					break
-				}
+		return matching, nil
+	}
+
+	// numbers, bools, times, slices, nested fields...
+	for id, doc := range coll.docs {
+		// check each value (there might be many, or none)
+		for _, val := range fp.docStrings(doc) {
+			if cmp(val) {
+				matching[id] = struct{}{}
+				break
 			}
 		}
-	default:
-		panic("can only query numeric, string and []string fields")
 	}
-	return matching
+	return matching, nil
 }
 
 // Find executes a query and fills out a slice containing the results.
@@ -186,9 +445,24 @@ func (coll *Collection) find(field string, cmp func(string) bool) docSet {
 // eg
 // var out []*Document
 // coll.Find(q, &out)
+// Panics upon error (see FindErr).
 func (coll *Collection) Find(q Query, result interface{}) {
-	coll.RLock()
-	defer coll.RUnlock()
+	if err := coll.FindErr(q, result); err != nil {
+		panic(err.Error())
+	}
+}
+
+// FindErr is the same as Find, but returns an error instead of panicking
+// (eg if the query refers to a field which can't be queried).
+func (coll *Collection) FindErr(q Query, result interface{}) error {
+	_, err := coll.FindWithOptions(q, result, FindOptions{})
+	return err
+}
+
+// FindWithOptions is the same as FindErr, but takes extra options,
+// eg to sort or page the results.
+// Returns details such as the total number of matches.
+func (coll *Collection) FindWithOptions(q Query, result interface{}, opts FindOptions) (FindInfo, error) {
 	var resultv, slicev reflect.Value
 	var elementt reflect.Type
 	var typeOK = false
@@ -205,33 +479,111 @@ func (coll *Collection) Find(q Query, result interface{}) {
 		}
 	}
 	if !typeOK {
-		panic("result must be pointer to a slice of pointers")
+		return FindInfo{}, fmt.Errorf("%w: result must be pointer to a slice of pointers (got %T)", ErrBadResult, result)
 	}
 
-	ids := q.perform(coll)
+	coll.RLock()
+	defer coll.RUnlock()
+	ids, err := coll.perform(q)
+	if err != nil {
+		return FindInfo{}, err
+	}
+	ordered, info, err := coll.order(ids, nil, &opts)
+	if err != nil {
+		return info, err
+	}
 
-	outv := reflect.MakeSlice(reflect.SliceOf(elementt), len(ids), len(ids))
-	idx := 0
-	for id, _ := range ids {
+	outv := reflect.MakeSlice(reflect.SliceOf(elementt), len(ordered), len(ordered))
+	for idx, id := range ordered {
 		doc := coll.docs[id]
 		docv := reflect.ValueOf(doc)
 		outv.Index(idx).Set(docv)
-		idx++
 	}
 	resultv.Elem().Set(outv)
+	return info, nil
 }
 
-//
+// perform executes a query, adding some context to any error.
+// The caller must hold the collection lock.
+func (coll *Collection) perform(q Query) (docSet, error) {
+	ids, err := q.perform(coll)
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", q, err)
+	}
+	return ids, nil
+}
+
+// Update calls modifyFn upon each doc matching the query, and returns the
+// number of docs visited.
+// For logged collections, the modified docs are written to the log before
+// Update returns.
+// Panics upon error (see UpdateErr).
 func (coll *Collection) Update(q Query, modifyFn func(interface{})) int {
+	cnt, err := coll.UpdateErr(q, modifyFn)
+	if err != nil {
+		panic(err.Error())
+	}
+	return cnt
+}
+
+// UpdateErr is the same as Update, but returns an error instead of
+// panicking. If the write-ahead log fails, the number of docs modified so
+// far is returned along with the error. The doc which couldn't be logged
+// is put back as it was (although only a shallow copy is kept, so changes
+// made inside slices, maps or pointed-to structs stay).
+// If the error is ErrLogSync, all the matching docs have been modified
+// (see ErrLogSync).
+func (coll *Collection) UpdateErr(q Query, modifyFn func(interface{})) (int, error) {
 	coll.Lock()
 	defer coll.Unlock()
-	ids := q.perform(coll)
+	ids, err := coll.perform(q)
+	if err != nil {
+		return 0, err
+	}
 	cnt := 0
 	for id, _ := range ids {
-		doc := coll.docs[id]
+		doc, got := coll.docs[id]
+		if !got {
+			// replaced by an earlier doc which changed it's key
+			continue
+		}
+		v := reflect.ValueOf(doc).Elem()
+		var saved reflect.Value
+		if coll.wal != nil {
+			// keep a (shallow) copy to put back if logging fails
+			saved = reflect.New(v.Type()).Elem()
+			saved.Set(v)
+		}
+		coll.unindexDoc(id)
 		modifyFn(doc)
+
+		// any other doc with the (new) key gets replaced
+		var replaced []uintptr
+		if coll.primary != nil {
+			if other, got := coll.primary.lookup(coll.primary.key(doc)); got && other != id {
+				replaced = append(replaced, other)
+			}
+		}
+		if coll.wal != nil {
+			if err := coll.wal.put(id, doc, replaced); err != nil {
+				v.Set(saved)
+				coll.indexDoc(id, doc)
+				return cnt, fmt.Errorf("write-ahead log failed: %w", err)
+			}
+		}
+		for _, other := range replaced {
+			coll.unindexDoc(other)
+			delete(coll.docs, other)
+			delete(coll.seqs, other)
+		}
+		coll.indexDoc(id, doc)
+		coll.dirty = true
 		cnt++
 	}
-	coll.dirty = true
-	return cnt
+	if coll.wal != nil {
+		if err := coll.wal.commit(); err != nil {
+			return cnt, err
+		}
+	}
+	return cnt, nil
 }
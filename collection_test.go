@@ -1,7 +1,11 @@
 package badger
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -33,6 +37,98 @@ func dummyCollection() *Collection {
 	return coll
 }
 
+func mustPerform(q Query, coll *Collection) docSet {
+	ids, err := q.perform(coll)
+	if err != nil {
+		panic(err)
+	}
+	return ids
+}
+
+func sameSet(a, b docSet) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, _ := range a {
+		if _, got := b[id]; !got {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutIndexes calls fn with all the collection's indexes (word, exact
+// and range) taken away, so queries have to scan the docs.
+func withoutIndexes(coll *Collection, fn func()) {
+	words, exacts, ranges := coll.wordIndexes, coll.exactIndexes, coll.rangeIndexes
+	coll.wordIndexes = map[string]*wordIndex{}
+	coll.exactIndexes = map[string]*exactIndex{}
+	coll.rangeIndexes = map[string]*rangeIndex{}
+	defer func() {
+		coll.wordIndexes, coll.exactIndexes, coll.rangeIndexes = words, exacts, ranges
+	}()
+	fn()
+}
+
+// assertIndexParity checks that the queries match exactly the same docs
+// using the collection's indexes as they do by scanning
+func assertIndexParity(t *testing.T, when string, coll *Collection, queries []Query) {
+	t.Helper()
+	for _, q := range queries {
+		indexed := mustPerform(q, coll)
+		var scanned docSet
+		withoutIndexes(coll, func() { scanned = mustPerform(q, coll) })
+		if !sameSet(indexed, scanned) {
+			t.Errorf("%s: %s: index gave %d matches, scan gave %d", when, q, len(indexed), len(scanned))
+		}
+	}
+}
+
+// queryTest is a query, along with the docs it should find (given as a
+// comma-separated list of their values for some field)
+type queryTest struct {
+	q      Query
+	expect string
+}
+
+// assertQueries runs the tests, both with the collection's indexes and by
+// scanning. Results are ordered by field, which is also the field listed
+// in queryTest.expect.
+func assertQueries(t *testing.T, when string, coll *Collection, field string, tests []queryTest) {
+	t.Helper()
+	fp, ok := coll.resolveField(field)
+	if !ok {
+		t.Fatalf("%s: no field %q", when, field)
+	}
+	find := func(q Query) (string, error) {
+		docs := reflect.New(reflect.SliceOf(coll.docType))
+		if _, err := coll.FindWithOptions(q, docs.Interface(), FindOptions{Sort: []SortKey{{field, Asc}}}); err != nil {
+			return "", err
+		}
+		vals := []string{}
+		for i := 0; i < docs.Elem().Len(); i++ {
+			vals = append(vals, fp.docStrings(docs.Elem().Index(i).Interface())...)
+		}
+		return strings.Join(vals, ","), nil
+	}
+	for _, test := range tests {
+		for _, indexed := range []bool{true, false} {
+			var got string
+			var err error
+			if indexed {
+				got, err = find(test.q)
+			} else {
+				withoutIndexes(coll, func() { got, err = find(test.q) })
+			}
+			if err != nil {
+				t.Errorf("%s (indexed=%v): %s: %s", when, indexed, test.q, err)
+			} else if got != test.expect {
+				t.Errorf("%s (indexed=%v): %s: got %q, expected %q", when, indexed, test.q, got, test.expect)
+			}
+		}
+	}
+}
+
 func TestFind(t *testing.T) {
 	coll := dummyCollection()
 
@@ -53,11 +149,11 @@ func TestSimple(t *testing.T) {
 		t.Error("Count error")
 	}
 
-	greens := NewExactQuery("Colour", "green").perform(coll)
+	greens := mustPerform(NewExactQuery("Colour", "green"), coll)
 	//	fmt.Println(greens)
-	reds := NewExactQuery("Colour", "crimson").perform(coll)
-	reds = Union(reds, NewExactQuery("Colour", "pink").perform(coll))
-	reds = Union(reds, NewExactQuery("Colour", "red").perform(coll))
+	reds := mustPerform(NewExactQuery("Colour", "crimson"), coll)
+	reds = Union(reds, mustPerform(NewExactQuery("Colour", "pink"), coll))
+	reds = Union(reds, mustPerform(NewExactQuery("Colour", "red"), coll))
 
 	//	fmt.Println(reds)
 	if len(greens) != 1 {
@@ -68,18 +164,18 @@ func TestSimple(t *testing.T) {
 	}
 
 	//
-	if len(NewExactQuery("Tags", "reddish").perform(coll)) != 3 {
+	if len(mustPerform(NewExactQuery("Tags", "reddish"), coll)) != 3 {
 		t.Error("wrong number tagged reddish")
 	}
-	if len(NewExactQuery("Tags", "uber").perform(coll)) != 0 {
+	if len(mustPerform(NewExactQuery("Tags", "uber"), coll)) != 0 {
 		t.Error("wrong number tagged uber")
 	}
 
-	if len(NewContainsQuery("Tags", "reddish").perform(coll)) != 3 {
+	if len(mustPerform(NewContainsQuery("Tags", "reddish"), coll)) != 3 {
 		t.Error("wrong number tagged reddish")
 	}
 
-	notgreens := NewNOTQuery(NewExactQuery("Colour", "green")).perform(coll)
+	notgreens := mustPerform(NewNOTQuery(NewExactQuery("Colour", "green")), coll)
 	if len(notgreens) != 4 {
 		t.Error("wrong number not green")
 	}
@@ -98,7 +194,7 @@ func TestUpdate(t *testing.T) {
 	}
 }
 
-func ExampleTestValidFields() {
+func ExampleCollection_ValidFields() {
 
 	// test struct with anonymous embedded struct
 	type ExtendedDoc struct {
@@ -112,3 +208,211 @@ func ExampleTestValidFields() {
 	// Output:
 	// [ID Colour Tags Details.Name Details.ShoeSize Extra]
 }
+
+func TestKeyedCollection(t *testing.T) {
+	coll := NewCollectionWithKey(&TestDoc{}, "id")
+	coll.AddIndex("colour", ExactIndex)
+	for _, doc := range []*TestDoc{
+		&TestDoc{"1", "red", []string{"primary"}, SubDoc{}},
+		&TestDoc{"2", "green", []string{"primary"}, SubDoc{}},
+		&TestDoc{"3", "blue", []string{"primary"}, SubDoc{}},
+	} {
+		coll.Put(doc)
+	}
+
+	// Put is an upsert
+	coll.Put(&TestDoc{"2", "pink", []string{"reddish"}, SubDoc{}})
+	if coll.Count() != 3 {
+		t.Errorf("upsert failed - expected 3 docs, got %d", coll.Count())
+	}
+	doc, ok := coll.Get("2").(*TestDoc)
+	if !ok || doc.Colour != "pink" {
+		t.Errorf("Get failed: got %v", doc)
+	}
+	if len(mustPerform(NewExactQuery("colour", "green"), coll)) != 0 {
+		t.Error("replaced doc still indexed")
+	}
+	if coll.Get("4") != nil {
+		t.Error("Get of missing key should return nil")
+	}
+
+	// remove via a copy
+	coll.Remove(&TestDoc{ID: "1"})
+	if coll.Count() != 2 || coll.Get("1") != nil {
+		t.Error("remove by key failed")
+	}
+
+	// changing a key to clash with another doc replaces it
+	coll.Update(NewExactQuery("id", "3"), func(doc interface{}) {
+		doc.(*TestDoc).ID = "2"
+	})
+	if coll.Count() != 1 || coll.Get("2").(*TestDoc).Colour != "blue" {
+		t.Error("key change in Update failed")
+	}
+	if coll.Get("3") != nil {
+		t.Error("old key still present after Update")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	coll := dummyCollection()
+	var out []*TestDoc
+
+	err := coll.FindErr(NewContainsQuery("wibble", "foo"), &out)
+	if !errors.Is(err, ErrUnknownField) {
+		t.Errorf("expected ErrUnknownField, got %v", err)
+	}
+	err = coll.FindErr(NewORQuery(NewAllQuery(), NewContainsQuery("details", "bob")), &out)
+	if !errors.Is(err, ErrUnsupportedField) {
+		t.Errorf("expected ErrUnsupportedField, got %v", err)
+	}
+	err = coll.FindErr(NewAllQuery(), out)
+	if !errors.Is(err, ErrBadResult) {
+		t.Errorf("expected ErrBadResult, got %v", err)
+	}
+	_, err = coll.UpdateErr(NewNOTQuery(NewExactQuery("wibble", "foo")), func(interface{}) {})
+	if !errors.Is(err, ErrUnknownField) {
+		t.Errorf("expected ErrUnknownField, got %v", err)
+	}
+	if err := coll.PutErr(&SubDoc{}); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch, got %v", err)
+	}
+	if err := coll.RemoveErr("wibble"); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch, got %v", err)
+	}
+	if coll.Count() != 5 {
+		t.Error("failed operations changed the collection")
+	}
+}
+
+type ScalarDoc struct {
+	Name   string
+	Big    int64
+	Small  uint8
+	Price  float64
+	Weight float32
+	OK     bool
+	Scores []float64
+	Counts []int
+	U      uint64
+}
+
+func TestScalarKinds(t *testing.T) {
+	coll := NewCollection(&ScalarDoc{})
+	coll.Put(&ScalarDoc{"a", 1 << 40, 7, 1.5, 0.1, true, []float64{0.5, 99}, []int{1, 2}, 1 << 63})
+	coll.Put(&ScalarDoc{"b", -3, 255, 10, 2.25, false, nil, []int{3}, 20})
+	coll.Put(&ScalarDoc{"c", 0, 0, -0.25, 100, true, []float64{-1}, nil, math.MaxUint64})
+
+	tests := []queryTest{
+		{NewExactQuery("price", "1.50"), "a"},
+		{NewExactQuery("weight", "0.1"), "a"},
+		{NewExactQuery("ok", "TRUE"), "a,c"},
+		{NewExactQuery("ok", "f"), "b"},
+		{NewExactQuery("small", "007"), "a"},
+		{NewExactQuery("big", fmt.Sprint(1<<40)), "a"},
+		{NewExactQuery("scores", "99"), "a"},
+		{NewRangeQuery("price", "1", "10"), "a,b"},
+		{NewRangeQuery("price", "-1", "1.5"), "a,c"},
+		{NewRangeQuery("price", "", "1.25"), "c"},
+		{NewRangeQuery("price", "9.5", ""), "b"},
+		{NewRangeQuery("weight", "0.05", "2.5"), "a,b"},
+		{NewRangeQuery("big", "-5.5", "0.5"), "b,c"},
+		{NewRangeQuery("small", "100", ""), "b"},
+		{NewRangeQuery("scores", "50", "100"), "a"},
+		{NewRangeQuery("counts", "2", "3"), "a,b"},
+		// uint64s too big for an int
+		{NewRangeQuery("u", "10", ""), "a,b,c"},
+		{NewRangeQuery("u", "", "100"), "b"},
+		{NewRangeQuery("u", "-5", "20"), "b"},
+		{NewRangeQuery("u", "21", "1000"), ""},
+		{NewRangeQuery("u", "", "-1"), ""},
+		{NewExactQuery("u", "18446744073709551615"), "c"},
+	}
+	assertQueries(t, "unindexed", coll, "name", tests)
+	for _, field := range []string{"big", "small", "price", "weight", "ok", "scores", "counts", "u"} {
+		coll.AddIndex(field, RangeIndex)
+		coll.AddIndex(field, ExactIndex)
+	}
+	assertQueries(t, "indexed", coll, "name", tests)
+
+	// floats sort numerically
+	var docs []*ScalarDoc
+	coll.FindWithOptions(NewAllQuery(), &docs, FindOptions{Sort: []SortKey{{"weight", Desc}}})
+	if docs[0].Name != "c" || docs[1].Name != "b" || docs[2].Name != "a" {
+		t.Errorf("float sort failed")
+	}
+
+	got, err := coll.Aggregate(NewAllQuery(), "scores", AggCount, AggSum)
+	if err != nil || got[0] != 3 || got[1] != 98.5 {
+		t.Errorf("aggregate over []float64 failed: %v %v", got, err)
+	}
+
+	fields := coll.Fields()
+	if fields[3].Name != "Price" || fields[3].Type.Kind() != reflect.Float64 || !fields[3].Queryable {
+		t.Errorf("bad field info: %+v", fields[3])
+	}
+}
+
+type Pet struct {
+	Name string
+	Age  int
+}
+
+type OwnerDoc struct {
+	Name    string
+	Details SubDoc
+	Partner *SubDoc
+	Pets    []Pet
+	Vets    []*SubDoc
+	Friends []*OwnerDoc
+}
+
+func TestNestedFields(t *testing.T) {
+	coll := NewCollection(&OwnerDoc{})
+	coll.Put(&OwnerDoc{Name: "a", Details: SubDoc{"Alice", 5},
+		Partner: &SubDoc{"Bob", 10},
+		Pets:    []Pet{{"Rex", 3}, {"Tiddles", 12}},
+		Vets:    []*SubDoc{nil, {"Dr Jones", 8}}})
+	coll.Put(&OwnerDoc{Name: "b", Details: SubDoc{"Bob", 11},
+		Pets: []Pet{{"Fido", 5}}})
+	coll.Put(&OwnerDoc{Name: "c", Details: SubDoc{"Carol", 6},
+		Friends: []*OwnerDoc{{Details: SubDoc{Name: "Alice"}}}})
+
+	got := strings.Join(coll.ValidFields(), ",")
+	expect := "Name,Details.Name,Details.ShoeSize,Partner.Name,Partner.ShoeSize,Pets.Name,Pets.Age,Vets.Name,Vets.ShoeSize"
+	if got != expect {
+		t.Errorf("ValidFields: got %s, expected %s", got, expect)
+	}
+
+	tests := []queryTest{
+		{NewContainsQuery("details.name", "bob"), "b"},
+		{NewExactQuery("Partner.Name", "bob"), "a"},
+		{NewRangeQuery("partner.shoesize", "", "100"), "a"},
+		{NewContainsQuery("pets.name", "i"), "a,b"},
+		{NewRangeQuery("pets.age", "10", ""), "a"},
+		{NewRangeQuery("pets.age", "4", "6"), "b"},
+		{NewExactQuery("vets.name", "dr jones"), "a"},
+		{NewContainsQuery("friends.details.name", "alice"), "c"},
+		{NewNOTQuery(NewContainsQuery("pets.name", "rex")), "b,c"},
+	}
+	assertQueries(t, "unindexed", coll, "name", tests)
+	coll.SetWholeWordField("details.name")
+	coll.AddIndex("partner.name", ExactIndex)
+	coll.AddIndex("partner.shoesize", RangeIndex)
+	coll.AddIndex("pets.age", RangeIndex)
+	coll.AddIndex("vets.name", ExactIndex)
+	assertQueries(t, "indexed", coll, "name", tests)
+
+	var docs []*OwnerDoc
+	coll.FindWithOptions(NewAllQuery(), &docs, FindOptions{Sort: []SortKey{{"details.shoesize", Desc}}})
+	if docs[0].Name != "b" || docs[1].Name != "c" || docs[2].Name != "a" {
+		t.Errorf("sort by nested field failed")
+	}
+
+	if _, err := coll.FindWithOptions(NewContainsQuery("pets", "rex"), &docs, FindOptions{}); !errors.Is(err, ErrUnsupportedField) {
+		t.Errorf("expected ErrUnsupportedField, got %v", err)
+	}
+	if _, err := coll.FindWithOptions(NewContainsQuery("pets.colour", "red"), &docs, FindOptions{}); !errors.Is(err, ErrUnknownField) {
+		t.Errorf("expected ErrUnknownField, got %v", err)
+	}
+}
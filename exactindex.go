@@ -0,0 +1,60 @@
+package badger
+
+// exactIndex is a hash index mapping (lowercased, maybe folded) field
+// values to the docs which hold them.
+type exactIndex struct {
+	field *fieldPath
+	// fold diacritics (see Collection.SetFolding)
+	fold   bool
+	values map[string]docSet
+	// the distinct values in each doc, so we can remove it later
+	docValues map[uintptr][]string
+}
+
+func newExactIndex(field *fieldPath, fold bool) *exactIndex {
+	return &exactIndex{
+		field:     field,
+		fold:      fold,
+		values:    make(map[string]docSet),
+		docValues: make(map[uintptr][]string),
+	}
+}
+
+func (idx *exactIndex) add(id uintptr, doc interface{}) {
+	vals := []string{}
+	for _, val := range idx.field.docStrings(doc) {
+		val = normalise(val, idx.fold)
+		docs, got := idx.values[val]
+		if !got {
+			docs = docSet{}
+			idx.values[val] = docs
+		}
+		if _, got := docs[id]; !got {
+			docs[id] = struct{}{}
+			vals = append(vals, val)
+		}
+	}
+	idx.docValues[id] = vals
+}
+
+func (idx *exactIndex) remove(id uintptr) {
+	for _, val := range idx.docValues[id] {
+		docs := idx.values[val]
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(idx.values, val)
+		}
+	}
+	delete(idx.docValues, id)
+}
+
+// lookup returns the docs which have any of the given (lowercase) values
+func (idx *exactIndex) lookup(values []string) docSet {
+	matching := docSet{}
+	for _, val := range values {
+		for id, _ := range idx.values[val] {
+			matching[id] = struct{}{}
+		}
+	}
+	return matching
+}
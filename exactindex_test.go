@@ -0,0 +1,40 @@
+package badger
+
+import (
+	"testing"
+)
+
+// check that exact indexes give exactly the same results as a scan
+func TestExactIndex(t *testing.T) {
+	coll := eventCollection(200)
+	coll.AddIndex("Name", ExactIndex)
+	coll.AddIndex("count", ExactIndex)
+	coll.AddIndex("Tags", ExactIndex)
+
+	queries := []Query{
+		NewExactQuery("name", "EVENT 12"),
+		NewExactQuery("name", "event 1", "event 199", "event 200"),
+		NewExactQuery("name", "event"),
+		NewExactQuery("count", "919"),
+		NewExactQuery("count", "0", "838"),
+		NewExactQuery("tags", "Tag3"),
+		NewExactQuery("tags", "tag3", "4"),
+		NewExactQuery("tags", ""),
+	}
+
+	assertIndexParity(t, "after Put", coll, queries)
+
+	coll.Update(NewExactQuery("tags", "tag3"), func(doc interface{}) {
+		ev := doc.(*EventDoc)
+		ev.Tags = append(ev.Tags, "tag4")
+		ev.Count = 919
+	})
+	assertIndexParity(t, "after Update", coll, queries)
+
+	var evs []*EventDoc
+	coll.Find(NewExactQuery("tags", "2"), &evs)
+	for _, ev := range evs {
+		coll.Remove(ev)
+	}
+	assertIndexParity(t, "after Remove", coll, queries)
+}
@@ -0,0 +1,95 @@
+package badger
+
+import (
+	"sort"
+)
+
+// FacetOptions controls which values FacetsWithOptions returns
+type FacetOptions struct {
+	// TopN limits the number of values returned per field (0 for no limit)
+	TopN int
+	// MinCount excludes values occurring in fewer than MinCount docs
+	MinCount int
+}
+
+// FacetCount is the number of docs holding a particular value
+type FacetCount struct {
+	Value string
+	Count int
+}
+
+// Facets counts the values of fields over all the docs matching a query.
+// Returns a map of field name to value counts. A doc holding the same
+// value more than once (eg in a []string field) only counts once.
+// Int fields are counted by their decimal string values.
+func (coll *Collection) Facets(q Query, fields ...string) (map[string]map[string]int, error) {
+	coll.RLock()
+	defer coll.RUnlock()
+	ids, err := coll.perform(q)
+	if err != nil {
+		return nil, err
+	}
+	return coll.facets(ids, fields)
+}
+
+// FacetsWithOptions is like Facets, but returns the counts for each field
+// as a list, most common values first (ties are sorted by value).
+func (coll *Collection) FacetsWithOptions(q Query, opts FacetOptions, fields ...string) (map[string][]FacetCount, error) {
+	counts, err := coll.Facets(q, fields...)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]FacetCount, len(counts))
+	for field, vals := range counts {
+		list := make([]FacetCount, 0, len(vals))
+		for val, cnt := range vals {
+			if cnt >= opts.MinCount {
+				list = append(list, FacetCount{val, cnt})
+			}
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Count != list[j].Count {
+				return list[i].Count > list[j].Count
+			}
+			return list[i].Value < list[j].Value
+		})
+		if opts.TopN > 0 && len(list) > opts.TopN {
+			list = list[:opts.TopN]
+		}
+		out[field] = list
+	}
+	return out, nil
+}
+
+// facets counts field values over the ids.
+// The caller must hold the collection lock.
+func (coll *Collection) facets(ids docSet, fields []string) (map[string]map[string]int, error) {
+	out := make(map[string]map[string]int, len(fields))
+	for _, field := range fields {
+		fp, err := coll.queryField(field)
+		if err != nil {
+			return nil, err
+		}
+		counts := map[string]int{}
+		for id, _ := range ids {
+			vals := fp.docStrings(coll.docs[id])
+			for i, val := range vals {
+				if !seenBefore(vals[:i], val) {
+					counts[val]++
+				}
+			}
+		}
+		out[field] = counts
+	}
+	return out, nil
+}
+
+// seenBefore returns true if val is in vals
+func seenBefore(vals []string, val string) bool {
+	for _, v := range vals {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
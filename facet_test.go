@@ -0,0 +1,57 @@
+package badger
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFacets(t *testing.T) {
+	coll := dummyCollection()
+	coll.Put(&TestDoc{"6", "red", []string{"reddish", "reddish", "warm"}, SubDoc{}})
+
+	facets, err := coll.Facets(NewAllQuery(), "tags", "Colour")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]int{"primary": 3, "reddish": 4, "warm": 1}
+	if !reflect.DeepEqual(facets["tags"], expect) {
+		t.Errorf("tags: got %v, expected %v", facets["tags"], expect)
+	}
+	if facets["Colour"]["red"] != 2 || len(facets["Colour"]) != 5 {
+		t.Errorf("colour: got %v", facets["Colour"])
+	}
+
+	// only over matching docs
+	facets, err = coll.Facets(NewExactQuery("colour", "red"), "tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = map[string]int{"primary": 1, "reddish": 2, "warm": 1}
+	if !reflect.DeepEqual(facets["tags"], expect) {
+		t.Errorf("tags for red: got %v, expected %v", facets["tags"], expect)
+	}
+
+	top, err := coll.FacetsWithOptions(NewAllQuery(), FacetOptions{TopN: 2, MinCount: 2}, "tags", "colour")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(top["tags"], []FacetCount{{"reddish", 4}, {"primary", 3}}) {
+		t.Errorf("top tags: got %v", top["tags"])
+	}
+	if !reflect.DeepEqual(top["colour"], []FacetCount{{"red", 2}}) {
+		t.Errorf("top colours: got %v", top["colour"])
+	}
+
+	events := eventCollection(20)
+	facets, err = events.Facets(NewAllQuery(), "count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(facets["count"]) != 20 {
+		t.Errorf("int facets: got %v", facets["count"])
+	}
+
+	if _, err := coll.Facets(NewAllQuery(), "wibble"); err == nil {
+		t.Error("facets on unknown field should fail")
+	}
+}
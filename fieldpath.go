@@ -0,0 +1,168 @@
+package badger
+
+import (
+	"reflect"
+	"strings"
+)
+
+// fieldPath locates a field within a doc. The field can be nested, using a
+// dotted path (eg "details.name") through structs, pointers to structs and
+// slices of structs. So a doc might have many values for a field (eg one
+// from each element of a slice), or none at all (eg if a pointer is nil).
+type fieldPath struct {
+	// Name is the proper path to the field, eg "Details.Name"
+	Name string
+	// Type is the type of the field at the end of the path
+	Type reflect.Type
+	// field index (as used by FieldByIndex) at each step of the path
+	steps [][]int
+	// set for plain top-level fields, which can be accessed directly
+	direct bool
+	// set if the field (or one it's nested in) is tagged noquery
+	noQuery bool
+}
+
+// resolvePath looks up a (possibly dotted) field path in the struct type
+// typ, case-insensitively. Fields go by the names given in their badger
+// tags, if any (see fieldTag).
+func resolvePath(typ reflect.Type, path string) (*fieldPath, bool) {
+	fp := &fieldPath{}
+	names := []string{}
+	for i, part := range strings.Split(path, ".") {
+		if i > 0 {
+			// step into the struct(s) held by the previous field
+			typ = structType(typ)
+			if typ == nil {
+				return nil, false
+			}
+		}
+		sf, tag, ok := lookupField(typ, part)
+		if !ok {
+			return nil, false
+		}
+		fp.steps = append(fp.steps, sf.Index)
+		names = append(names, tag.queryName(sf))
+		fp.noQuery = fp.noQuery || tag.noQuery
+		typ = sf.Type
+	}
+	fp.Name = strings.Join(names, ".")
+	fp.Type = typ
+	fp.direct = len(fp.steps) == 1 && len(fp.steps[0]) == 1
+	return fp, true
+}
+
+// buildSchema resolves all the field paths in the struct type typ up
+// front, keyed by lowercase path, so fields can be looked up without any
+// reflection or tag parsing. Paths into recursive types are only followed
+// one level deep (eg "friends.name", but not "friends.friends.name").
+func buildSchema(typ reflect.Type) map[string]*fieldPath {
+	schema := map[string]*fieldPath{}
+	for _, path := range pathNames(typ, "", map[reflect.Type]int{}) {
+		// (ambiguous paths won't resolve)
+		if fp, ok := resolvePath(typ, path); ok {
+			schema[strings.ToLower(path)] = fp
+		}
+	}
+	return schema
+}
+
+// pathNames lists the possible field paths in struct type typ, including
+// fields promoted from embedded structs. seen counts the structs already
+// being listed, to avoid looping forever on recursive types.
+func pathNames(typ reflect.Type, prefix string, seen map[reflect.Type]int) []string {
+	seen[typ]++
+	defer func() { seen[typ]-- }()
+	names := []string{}
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		tag := parseTag(sf)
+		if tag.ignore {
+			continue
+		}
+		name := prefix + tag.queryName(sf)
+		names = append(names, name)
+		st := structType(sf.Type)
+		if st == nil {
+			continue
+		}
+		if seen[st] > 1 {
+			continue
+		}
+		names = append(names, pathNames(st, name+".", seen)...)
+		if tag.promoted(sf) {
+			names = append(names, pathNames(st, prefix, seen)...)
+		}
+	}
+	return names
+}
+
+// structType returns the struct type which a path can step into from a
+// field of type t (a struct, or a pointer to, or slice of, structs).
+// Returns nil if t doesn't hold structs.
+func structType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return nil
+	}
+	return t
+}
+
+// values returns the value(s) of the field in doc
+func (fp *fieldPath) values(doc interface{}) []reflect.Value {
+	return walkPath(reflect.ValueOf(doc).Elem(), fp.steps, nil)
+}
+
+// docStrings returns the value(s) of the field in doc as strings (see
+// fieldStrings)
+func (fp *fieldPath) docStrings(doc interface{}) []string {
+	if fp.direct {
+		return fieldStrings(reflect.ValueOf(doc).Elem().Field(fp.steps[0][0]))
+	}
+	out := []string{}
+	for _, f := range fp.values(doc) {
+		out = append(out, fieldStrings(f)...)
+	}
+	return out
+}
+
+// walkPath follows the path steps from the struct s, appending the
+// field values found at the end of it to out.
+func walkPath(s reflect.Value, steps [][]int, out []reflect.Value) []reflect.Value {
+	f, err := s.FieldByIndexErr(steps[0])
+	if err != nil {
+		// nil embedded struct pointer
+		return out
+	}
+	if len(steps) == 1 {
+		return append(out, f)
+	}
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			return out
+		}
+		f = f.Elem()
+	}
+	if f.Kind() != reflect.Slice {
+		return walkPath(f, steps[1:], out)
+	}
+	// any element can match
+	for i := 0; i < f.Len(); i++ {
+		e := f.Index(i)
+		if e.Kind() == reflect.Ptr {
+			if e.IsNil() {
+				continue
+			}
+			e = e.Elem()
+		}
+		out = walkPath(e, steps[1:], out)
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+package badger
+
+import (
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	for _, test := range []struct {
+		in, expect string
+	}{
+		{"plain", "plain"},
+		{"À la lune", "A la lune"},
+		{"à la lune", "a la lune"}, // NFD
+		{"Crème Brûlée", "Creme Brulee"},
+		{"Straße", "Strasse"},
+		{"Æsir", "AEsir"},
+		{"Ωμέγα", "Ωμεγα"},
+		{"東京", "東京"},
+	} {
+		if got := Fold(test.in); got != test.expect {
+			t.Errorf("Fold(%q): got %q, expected %q", test.in, got, test.expect)
+		}
+	}
+}
+
+type DishDoc struct {
+	Name   string
+	Course string
+}
+
+func TestFolding(t *testing.T) {
+	coll := NewCollection(&DishDoc{})
+	coll.SetWholeWordField("name")
+	coll.Put(&DishDoc{"Crème brûlée", "Dessert"})
+	coll.Put(&DishDoc{"Creme caramel", "Dessert"})
+	coll.Put(&DishDoc{"Pâté", "Entrée"})
+
+	tests := []struct {
+		q        Query
+		folded   string
+		unfolded string
+	}{
+		{NewContainsQuery("name", "creme"), "Creme caramel,Crème brûlée", "Creme caramel"},
+		{NewContainsQuery("name", "crème brulee"), "Crème brûlée", ""},
+		{NewContainsQuery("course", "ENTREE"), "Pâté", ""},
+		{NewExactQuery("name", "pate"), "Pâté", ""},
+		{NewExactQuery("course", "entrée"), "Pâté", "Pâté"},
+		{NewRangeQuery("name", "pa", "pb"), "Pâté", ""},
+	}
+	check := func(when string, folding bool) {
+		queries := []queryTest{}
+		for _, test := range tests {
+			if folding {
+				queries = append(queries, queryTest{test.q, test.folded})
+			} else {
+				queries = append(queries, queryTest{test.q, test.unfolded})
+			}
+		}
+		assertQueries(t, when, coll, "name", queries)
+	}
+
+	check("unfolded", false)
+	coll.SetFolding(true)
+	check("folded", true)
+	for _, field := range []string{"name", "course"} {
+		coll.AddIndex(field, ExactIndex)
+		coll.AddIndex(field, RangeIndex)
+	}
+	check("folded, indexed", true)
+	coll.SetFolding(false)
+	check("unfolded, indexed", false)
+}
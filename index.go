@@ -0,0 +1,222 @@
+package badger
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IndexType specifies a kind of index which can be added to a field
+type IndexType int
+
+const (
+	// RangeIndex keeps the field values in order, to speed up range queries
+	RangeIndex IndexType = iota
+	// ExactIndex is a hash index (case-insensitive), to speed up exact queries
+	ExactIndex
+)
+
+// index is implemented by anything which needs to be kept in sync with
+// the documents in a collection.
+// add() is called when a document is Put (or after it is modified by
+// Update), and remove() when it is removed (or just before it is modified).
+// Implementations need to remember enough about each doc to remove it
+// without looking at the doc again, as it might have changed in the meantime.
+type index interface {
+	add(id uintptr, doc interface{})
+	remove(id uintptr)
+}
+
+// AddIndex adds an index to a field, to speed up queries upon it.
+// Any documents already in the collection are indexed immediately.
+// Adding an index doesn't change query results, only how fast they come back.
+func (coll *Collection) AddIndex(fieldName string, typ IndexType) {
+	coll.Lock()
+	defer coll.Unlock()
+
+	field := strings.ToLower(fieldName)
+	fp, ok := coll.resolveField(field)
+	if !ok {
+		panic("couldn't resolve field " + field)
+	}
+	if fp.noQuery || !queryableType(fp.Type) {
+		panic("can only index string, numeric, bool and time fields (or slices of them)")
+	}
+
+	var idx index
+	switch typ {
+	case RangeIndex:
+		if _, got := coll.rangeIndexes[field]; got {
+			return
+		}
+		ri := newRangeIndex(fp, coll.fold)
+		coll.rangeIndexes[field] = ri
+		idx = ri
+	case ExactIndex:
+		if _, got := coll.exactIndexes[field]; got {
+			return
+		}
+		ei := newExactIndex(fp, coll.fold)
+		coll.exactIndexes[field] = ei
+		idx = ei
+	default:
+		panic("unknown index type")
+	}
+
+	for id, doc := range coll.docs {
+		idx.add(id, doc)
+	}
+}
+
+// indexDoc adds a doc to all the indexes in the collection
+func (coll *Collection) indexDoc(id uintptr, doc interface{}) {
+	if coll.primary != nil {
+		coll.primary.add(id, doc)
+	}
+	for _, idx := range coll.wordIndexes {
+		idx.add(id, doc)
+	}
+	for _, idx := range coll.rangeIndexes {
+		idx.add(id, doc)
+	}
+	for _, idx := range coll.exactIndexes {
+		idx.add(id, doc)
+	}
+}
+
+// unindexDoc removes a doc from all the indexes in the collection
+func (coll *Collection) unindexDoc(id uintptr) {
+	if coll.primary != nil {
+		coll.primary.remove(id)
+	}
+	for _, idx := range coll.wordIndexes {
+		idx.remove(id)
+	}
+	for _, idx := range coll.rangeIndexes {
+		idx.remove(id)
+	}
+	for _, idx := range coll.exactIndexes {
+		idx.remove(id)
+	}
+}
+
+// timeType is the type of time.Time fields
+var timeType = reflect.TypeOf(time.Time{})
+
+// timeLayout is used to format time fields as strings. They are always in
+// UTC, and fixed width so they sort in order.
+const timeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// fieldStrings returns the value(s) of a field as strings, in the same
+// form Collection.find passes them to it's cmp fn.
+// Zero times and nil pointers don't have any value.
+func fieldStrings(f reflect.Value) []string {
+	switch f.Kind() {
+	case reflect.Struct:
+		// time.Time
+		t := f.Interface().(time.Time)
+		if t.IsZero() {
+			return nil
+		}
+		return []string{t.UTC().Format(timeLayout)}
+	case reflect.Ptr:
+		// eg *time.Time
+		if f.IsNil() {
+			return nil
+		}
+		return fieldStrings(f.Elem())
+	case reflect.Bool:
+		return []string{strconv.FormatBool(f.Bool())}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []string{strconv.FormatInt(f.Int(), 10)}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return []string{strconv.FormatUint(f.Uint(), 10)}
+	case reflect.Float32, reflect.Float64:
+		return []string{strconv.FormatFloat(f.Float(), 'g', -1, f.Type().Bits())}
+	case reflect.String:
+		return []string{f.String()}
+	case reflect.Slice:
+		out := make([]string, 0, f.Len())
+		for i := 0; i < f.Len(); i++ {
+			out = append(out, fieldStrings(f.Index(i))...)
+		}
+		return out
+	}
+	return nil
+}
+
+// normaliseValue converts a value from a query into the form fieldStrings
+// would give for a field of type t, so they can be compared as strings
+// (eg "1.50" becomes "1.5" for float fields).
+// Values which don't parse are returned unchanged.
+func normaliseValue(t reflect.Type, val string) string {
+	t = baseType(t)
+	if t == timeType {
+		if tm, ok := parseTime(val); ok {
+			return timeKey(tm)
+		}
+		return val
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(val); err == nil {
+			return strconv.FormatBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, err := strconv.ParseInt(val, 10, t.Bits()); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, err := strconv.ParseUint(val, 10, t.Bits()); err == nil {
+			return strconv.FormatUint(n, 10)
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, err := strconv.ParseFloat(val, t.Bits()); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, t.Bits())
+		}
+	}
+	return val
+}
+
+// baseType returns the type of the individual values in a field of type t
+// (ie without any slice or pointer)
+func baseType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// numericKind returns true for int, uint and float kinds
+func numericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// queryableType returns true if fields of type t can be queried (and
+// indexed): strings, numbers, bools, times and slices of, or pointers to,
+// them.
+func queryableType(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Slice && queryableType(t.Elem())
+	case reflect.Ptr:
+		k := t.Elem().Kind()
+		return k != reflect.Slice && k != reflect.Ptr && queryableType(t.Elem())
+	}
+	return numericKind(t.Kind())
+}
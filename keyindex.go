@@ -0,0 +1,47 @@
+package badger
+
+// keyIndex maps primary keys to docs, for collections created with
+// NewCollectionWithKey. Keys are held as strings (int keys are formatted
+// in decimal).
+type keyIndex struct {
+	field *fieldPath
+	ids   map[string]uintptr
+	// the key each doc was indexed under, in case it changes
+	keys map[uintptr]string
+}
+
+func newKeyIndex(field *fieldPath) *keyIndex {
+	return &keyIndex{
+		field: field,
+		ids:   make(map[string]uintptr),
+		keys:  make(map[uintptr]string),
+	}
+}
+
+// key returns the primary key of a doc
+func (idx *keyIndex) key(doc interface{}) string {
+	return idx.field.docStrings(doc)[0]
+}
+
+func (idx *keyIndex) add(id uintptr, doc interface{}) {
+	key := idx.key(doc)
+	idx.ids[key] = id
+	idx.keys[id] = key
+}
+
+func (idx *keyIndex) remove(id uintptr) {
+	key, got := idx.keys[id]
+	if !got {
+		return
+	}
+	if idx.ids[key] == id {
+		delete(idx.ids, key)
+	}
+	delete(idx.keys, id)
+}
+
+// lookup returns the id of the doc with the given key
+func (idx *keyIndex) lookup(key string) (uintptr, bool) {
+	id, got := idx.ids[key]
+	return id, got
+}
@@ -2,13 +2,18 @@ package badger
 
 import (
 	"fmt"
+	"math"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Query interface {
-	perform(coll *Collection) docSet
+	perform(coll *Collection) (docSet, error)
+	// score is like perform, but also rates how well each doc matched
+	score(coll *Collection) (docScores, error)
 	String() string
 }
 
@@ -24,8 +29,12 @@ func (q *nilQuery) String() string {
 	return "<NONE>"
 }
 
-func (q *nilQuery) perform(coll *Collection) docSet {
-	return docSet{}
+func (q *nilQuery) perform(coll *Collection) (docSet, error) {
+	return docSet{}, nil
+}
+
+func (q *nilQuery) score(coll *Collection) (docScores, error) {
+	return docScores{}, nil
 }
 
 type allQuery struct {
@@ -40,8 +49,12 @@ func (q *allQuery) String() string {
 	return "<ALL>"
 }
 
-func (q *allQuery) perform(coll *Collection) docSet {
-	return coll.findAll()
+func (q *allQuery) perform(coll *Collection) (docSet, error) {
+	return coll.findAll(), nil
+}
+
+func (q *allQuery) score(coll *Collection) (docScores, error) {
+	return zeroScores(coll.findAll()), nil
 }
 
 //
@@ -61,14 +74,36 @@ func NewExactQuery(field string, values ...string) Query {
 }
 
 func (q *exactQuery) String() string {
-	// TODO
-	return q.field + ":blahblah"
+	if len(q.values) == 1 {
+		return fmt.Sprintf(`%s:=%s`, q.field, q.values[0])
+	} else {
+		return fmt.Sprintf(`%s:= IN %v`, q.field, q.values)
+	}
 }
 
-func (q *exactQuery) perform(coll *Collection) docSet {
+func (q *exactQuery) score(coll *Collection) (docScores, error) {
+	ids, err := q.perform(coll)
+	return zeroScores(ids), err
+}
+
+func (q *exactQuery) perform(coll *Collection) (docSet, error) {
+	fp, err := coll.queryField(q.field)
+	if err != nil {
+		return nil, err
+	}
+	// put the values in the same form as the field (eg "1.50" => "1.5"
+	// for floats)
+	values := make([]string, len(q.values))
+	for i, v := range q.values {
+		values[i] = normalise(normaliseValue(fp.Type, v), coll.fold)
+	}
+
+	if idx, got := coll.exactIndexes[strings.ToLower(q.field)]; got {
+		return idx.lookup(values), nil
+	}
 	return coll.find(q.field, func(foo string) bool {
-		foo = strings.ToLower(foo)
-		for _, v := range q.values {
+		foo = normalise(foo, coll.fold)
+		for _, v := range values {
 			if foo == v {
 				return true
 			}
@@ -88,21 +123,29 @@ func NewContainsQuery(field, value string) Query {
 }
 
 func (q *containsQuery) String() string {
-	// TODO
 	if len(q.values) == 1 {
-		return fmt.Sprintf(`%s:%s`, q.field, q.values[0])
+		v := q.values[0]
+		if strings.ContainsAny(v, " \t\n") {
+			// a phrase
+			v = `"` + v + `"`
+		}
+		return fmt.Sprintf(`%s:%s`, q.field, v)
 	} else {
 		return fmt.Sprintf(`%s: IN %v`, q.field, q.values)
 	}
 }
 
-func (q *containsQuery) perform(coll *Collection) docSet {
+func (q *containsQuery) perform(coll *Collection) (docSet, error) {
 
 	if _, got := coll.wholeWordFields[strings.ToLower(q.field)]; !got {
 		// no whole-word check needed - just plain string search
+		values := make([]string, len(q.values))
+		for i, v := range q.values {
+			values[i] = normalise(v, coll.fold)
+		}
 		return coll.find(q.field, func(foo string) bool {
-			foo = strings.ToLower(foo)
-			for _, v := range q.values {
+			foo = normalise(foo, coll.fold)
+			for _, v := range values {
 				if strings.Contains(foo, v) {
 					return true
 				}
@@ -113,37 +156,23 @@ func (q *containsQuery) perform(coll *Collection) docSet {
 	} else {
 		// require whole-word matching (ie "tory" does not match "history")
 
+		if idx, got := coll.wordIndexes[strings.ToLower(q.field)]; got {
+			if matching, ok := q.lookup(idx); ok {
+				return matching, nil
+			}
+		}
+
+		analyzer := coll.analyzer(q.field)
+		phrases := [][]Token{}
+		for _, v := range q.values {
+			// the search phrase might tokenise into multiple terms
+			phrases = append(phrases, analyzer.Analyze(v))
+		}
 		return coll.find(q.field, func(foo string) bool {
-			/*
-				// 1st pass - just do string search
-				found := false
-				foo = strings.ToLower(foo)
-				for _, v := range q.values {
-					if strings.Contains(foo, v) {
-						found = true
-					}
-				}
-				if !found {
-					return false
-				}
-			*/
-
-			// now do more rigorous check:
-			searchSpace := Tokenise(foo)
-			for _, v := range q.values {
-				// the search phrase might tokenise into multiple terms
-				searchTerms := Tokenise(v)
-				for pos := 0; pos <= len(searchSpace)-len(searchTerms); pos++ {
-					t := 0
-					for ; t < len(searchTerms); t++ {
-						if searchSpace[pos+t] != searchTerms[t] {
-							break
-						}
-					}
-					if t == len(searchTerms) {
-						// got a full match!
-						return true
-					}
+			searchSpace := analyzer.Analyze(foo)
+			for _, phrase := range phrases {
+				if phraseMatch(searchSpace, phrase) {
+					return true
 				}
 			}
 			return false
@@ -152,6 +181,45 @@ func (q *containsQuery) perform(coll *Collection) docSet {
 
 }
 
+// score rates matching docs using BM25
+func (q *containsQuery) score(coll *Collection) (docScores, error) {
+	ids, err := q.perform(coll)
+	if err != nil {
+		return nil, err
+	}
+	terms := []string{}
+	analyzer := coll.analyzer(q.field)
+	for _, v := range q.values {
+		terms = append(terms, termsOf(analyzer.Analyze(v))...)
+	}
+	_, wholeWord := coll.wholeWordFields[strings.ToLower(q.field)]
+	stats, err := coll.textStats(q.field, terms, wholeWord)
+	if err != nil {
+		return nil, err
+	}
+	boost := coll.fieldBoost(q.field)
+	scores := make(docScores, len(ids))
+	for id, _ := range ids {
+		scores[id] = stats.bm25(id, terms) * boost
+	}
+	return scores, nil
+}
+
+// lookup performs a whole-word search using an inverted index.
+// Returns false if the search can't be done with the index (eg
+// a value which doesn't produce any tokens).
+func (q *containsQuery) lookup(idx *wordIndex) (docSet, bool) {
+	matching := docSet{}
+	for _, v := range q.values {
+		phrase := idx.analyzer.Analyze(v)
+		if len(phrase) == 0 {
+			return nil, false
+		}
+		matching = Union(matching, idx.lookup(phrase))
+	}
+	return matching, true
+}
+
 type notQuery struct {
 	subQuery Query
 }
@@ -164,10 +232,19 @@ func (q *notQuery) String() string {
 	return "-" + q.subQuery.String()
 }
 
-func (q *notQuery) perform(coll *Collection) docSet {
+func (q *notQuery) score(coll *Collection) (docScores, error) {
+	ids, err := q.perform(coll)
+	return zeroScores(ids), err
+}
+
+func (q *notQuery) perform(coll *Collection) (docSet, error) {
+	sub, err := q.subQuery.perform(coll)
+	if err != nil {
+		return nil, err
+	}
 	out := coll.findAll()
-	out.Subtract(q.subQuery.perform(coll))
-	return out
+	out.Subtract(sub)
+	return out, nil
 }
 
 type orQuery struct {
@@ -182,10 +259,31 @@ func (q *orQuery) String() string {
 	return "(" + q.left.String() + " OR " + q.right.String() + ")"
 }
 
-func (q *orQuery) perform(coll *Collection) docSet {
-	a := q.left.perform(coll)
-	b := q.right.perform(coll)
-	return Union(a, b)
+func (q *orQuery) score(coll *Collection) (docScores, error) {
+	a, err := q.left.score(coll)
+	if err != nil {
+		return nil, err
+	}
+	b, err := q.right.score(coll)
+	if err != nil {
+		return nil, err
+	}
+	for id, s := range b {
+		a[id] += s
+	}
+	return a, nil
+}
+
+func (q *orQuery) perform(coll *Collection) (docSet, error) {
+	a, err := q.left.perform(coll)
+	if err != nil {
+		return nil, err
+	}
+	b, err := q.right.perform(coll)
+	if err != nil {
+		return nil, err
+	}
+	return Union(a, b), nil
 }
 
 type andQuery struct {
@@ -201,10 +299,65 @@ func (q *andQuery) String() string {
 	return "(" + q.left.String() + " AND " + q.right.String() + ")"
 }
 
-func (q *andQuery) perform(coll *Collection) docSet {
-	a := q.left.perform(coll)
-	b := q.right.perform(coll)
-	return Intersect(a, b)
+func (q *andQuery) score(coll *Collection) (docScores, error) {
+	a, err := q.left.score(coll)
+	if err != nil {
+		return nil, err
+	}
+	b, err := q.right.score(coll)
+	if err != nil {
+		return nil, err
+	}
+	out := docScores{}
+	for id, s := range a {
+		if sb, got := b[id]; got {
+			out[id] = s + sb
+		}
+	}
+	return out, nil
+}
+
+func (q *andQuery) perform(coll *Collection) (docSet, error) {
+	a, err := q.left.perform(coll)
+	if err != nil {
+		return nil, err
+	}
+	b, err := q.right.perform(coll)
+	if err != nil {
+		return nil, err
+	}
+	return Intersect(a, b), nil
+}
+
+type boostQuery struct {
+	subQuery Query
+	boost    float64
+}
+
+// NewBoostQuery returns a query which matches the same docs as q, but with
+// scores multiplied by boost (eg to make hits in one part of a query count
+// for more than another).
+func NewBoostQuery(q Query, boost float64) Query {
+	return &boostQuery{subQuery: q, boost: boost}
+}
+
+func (q *boostQuery) String() string {
+	return fmt.Sprintf("%s^%g", q.subQuery.String(), q.boost)
+}
+
+func (q *boostQuery) perform(coll *Collection) (docSet, error) {
+	return q.subQuery.perform(coll)
+}
+
+func (q *boostQuery) score(coll *Collection) (docScores, error) {
+	scores, err := q.subQuery.score(coll)
+	if err != nil {
+		return nil, err
+	}
+	for id, _ := range scores {
+		scores[id] *= q.boost
+	}
+	return scores, nil
 }
 
 const maxUint = ^uint(0)
@@ -214,6 +367,40 @@ const minInt = -maxInt - 1
 
 var dateExtractPat *regexp.Regexp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
 
+// timeExtractPat picks out a date, with optional time and timezone.
+// The T and Z can be lowercase, as query values often get lowercased.
+var timeExtractPat *regexp.Regexp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}(?:[Tt]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:[Zz]|[+-]\d{2}:\d{2})?)?`)
+
+// layouts accepted by parseTime (fractional seconds are always allowed)
+var timeLayouts = []string{
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseTime picks a time out of a string (eg "2010-06-14", or a RFC3339
+// timestamp like "2010-06-14T10:20:00+01:00").
+// Times without a timezone are taken to be UTC.
+func parseTime(s string) (time.Time, bool) {
+	s = strings.ToUpper(timeExtractPat.FindString(s))
+	if s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// timeKey formats a time so that keys sort in time order
+func timeKey(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
 // NewRangeQuery returns a query to match docs with field values within
 // inclusive range [first,last]
 func NewRangeQuery(field, first, last string) Query {
@@ -222,6 +409,18 @@ func NewRangeQuery(field, first, last string) Query {
 	if first == "" && last == "" {
 		return NewNilQuery()
 	}
+	if isTimestamp(first) || isTimestamp(last) {
+		// at least one bound has a time as well as a date
+		a, aOK := parseTime(first)
+		b, bOK := parseTime(last)
+		if (aOK || first == "") && (bOK || last == "") {
+			if bOK && datePat.MatchString(last) {
+				// plain date - include the whole day
+				b = b.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+			return &timeRangeQuery{field, a, b}
+		}
+	}
 	if first == "" && datePat.MatchString(last) {
 		return &dateRangeQuery{field, first, last}
 	}
@@ -246,6 +445,18 @@ func NewRangeQuery(field, first, last string) Query {
 		return &intRangeQuery{field, a, b}
 	}
 
+	fa, faOK := parseFloat(first)
+	fb, fbOK := parseFloat(last)
+	if first == "" && fbOK {
+		return &floatRangeQuery{field, math.Inf(-1), fb}
+	}
+	if faOK && last == "" {
+		return &floatRangeQuery{field, fa, math.Inf(1)}
+	}
+	if faOK && fbOK {
+		return &floatRangeQuery{field, fa, fb}
+	}
+
 	return &strRangeQuery{field, strings.ToLower(first), strings.ToLower(last)}
 
 }
@@ -258,12 +469,21 @@ type strRangeQuery struct {
 func (q *strRangeQuery) String() string {
 	return q.field + ": [" + q.first + " TO " + q.last + "]"
 }
-func (q *strRangeQuery) perform(coll *Collection) docSet {
+func (q *strRangeQuery) score(coll *Collection) (docScores, error) {
+	ids, err := q.perform(coll)
+	return zeroScores(ids), err
+}
+
+func (q *strRangeQuery) perform(coll *Collection) (docSet, error) {
 	// straight string compare
 	// TODO: less-than/greater-than special cases
+	first, last := normalise(q.first, coll.fold), normalise(q.last, coll.fold)
+	if idx, got := coll.rangeIndexes[strings.ToLower(q.field)]; got {
+		return idx.between(&idx.strs, first, last), nil
+	}
 	return coll.find(q.field, func(foo string) bool {
-		foo = strings.ToLower(foo)
-		return foo >= q.first && foo <= q.last
+		foo = normalise(foo, coll.fold)
+		return foo >= first && foo <= last
 	})
 }
 
@@ -276,8 +496,20 @@ func (q *dateRangeQuery) String() string {
 	return q.field + ": [" + q.first + " TO " + q.last + "]"
 }
 
-func (q *dateRangeQuery) perform(coll *Collection) docSet {
+func (q *dateRangeQuery) score(coll *Collection) (docScores, error) {
+	ids, err := q.perform(coll)
+	return zeroScores(ids), err
+}
+
+func (q *dateRangeQuery) perform(coll *Collection) (docSet, error) {
 	// date compare
+	if idx, got := coll.rangeIndexes[strings.ToLower(q.field)]; got {
+		last := q.last
+		if last == "" {
+			last = "9999-99-99"
+		}
+		return idx.between(&idx.dates, q.first, last), nil
+	}
 	if q.first == "" {
 		// less-than-or-equal-to
 		return coll.find(q.field, func(foo string) bool {
@@ -319,7 +551,23 @@ func (q *intRangeQuery) String() string {
 	return fmt.Sprintf("%s: [%d TO %d]", q.field, q.first, q.last)
 }
 
-func (q *intRangeQuery) perform(coll *Collection) docSet {
+func (q *intRangeQuery) score(coll *Collection) (docScores, error) {
+	ids, err := q.perform(coll)
+	return zeroScores(ids), err
+}
+
+func (q *intRangeQuery) perform(coll *Collection) (docSet, error) {
+	if fp, ok := coll.resolveField(q.field); ok && isFloatType(fp.Type) {
+		// ints won't do for comparing floats
+		return q.floatRange().perform(coll)
+	}
+	if fp, ok := coll.resolveField(q.field); ok && isUnsignedType(fp.Type) {
+		// nor for uints too big for an int
+		return q.performUnsigned(coll)
+	}
+	if idx, got := coll.rangeIndexes[strings.ToLower(q.field)]; got {
+		return idx.between(&idx.ints, intKey(q.first), intKey(q.last)), nil
+	}
 	return coll.find(q.field, func(foo string) bool {
 		v, err := strconv.Atoi(foo)
 		if err != nil {
@@ -328,3 +576,165 @@ func (q *intRangeQuery) perform(coll *Collection) docSet {
 		return v >= q.first && v <= q.last
 	})
 }
+
+// isTimestamp returns true if s is a date with a time (eg RFC3339)
+func isTimestamp(s string) bool {
+	t := timeExtractPat.FindString(s)
+	return t != "" && t == s && len(t) > len("2006-01-02")
+}
+
+// time range, inclusive. Zero times are open-ended.
+type timeRangeQuery struct {
+	field       string
+	first, last time.Time
+}
+
+// NewTimeRangeQuery returns a query to match docs with times within the
+// inclusive range [first,last]. A zero time leaves that end of the range
+// open.
+// Times are compared as instants, so timezones are taken into account.
+// For string fields, the time is picked out of the text (see parseTime).
+func NewTimeRangeQuery(field string, first, last time.Time) Query {
+	if first.IsZero() && last.IsZero() {
+		return NewNilQuery()
+	}
+	return &timeRangeQuery{field, first, last}
+}
+
+func (q *timeRangeQuery) String() string {
+	var first, last string
+	if !q.first.IsZero() {
+		first = q.first.Format(time.RFC3339Nano)
+	}
+	if !q.last.IsZero() {
+		last = q.last.Format(time.RFC3339Nano)
+	}
+	return q.field + ": [" + first + " TO " + last + "]"
+}
+
+func (q *timeRangeQuery) score(coll *Collection) (docScores, error) {
+	ids, err := q.perform(coll)
+	return zeroScores(ids), err
+}
+
+func (q *timeRangeQuery) perform(coll *Collection) (docSet, error) {
+	first, last := "", "~"
+	if !q.first.IsZero() {
+		first = timeKey(q.first)
+	}
+	if !q.last.IsZero() {
+		last = timeKey(q.last)
+	}
+	if idx, got := coll.rangeIndexes[strings.ToLower(q.field)]; got {
+		return idx.between(&idx.times, first, last), nil
+	}
+	return coll.find(q.field, func(foo string) bool {
+		t, ok := parseTime(foo)
+		if !ok {
+			return false
+		}
+		k := timeKey(t)
+		return k >= first && k <= last
+	})
+}
+
+// performUnsigned performs the query upon an unsigned field
+func (q *intRangeQuery) performUnsigned(coll *Collection) (docSet, error) {
+	first, last, ok := q.uintRange()
+	if !ok {
+		return docSet{}, nil
+	}
+	if idx, got := coll.rangeIndexes[strings.ToLower(q.field)]; got {
+		return idx.between(&idx.uints, uintKey(first), uintKey(last)), nil
+	}
+	return coll.find(q.field, func(foo string) bool {
+		v, err := strconv.ParseUint(foo, 10, 64)
+		if err != nil {
+			return false
+		}
+		return v >= first && v <= last
+	})
+}
+
+// uintRange returns the equivalent uint64 range. ok is false if no
+// unsigned value can match.
+func (q *intRangeQuery) uintRange() (first, last uint64, ok bool) {
+	if q.last < 0 {
+		return 0, 0, false
+	}
+	if q.first > 0 {
+		first = uint64(q.first)
+	}
+	last = math.MaxUint64
+	if q.last != maxInt {
+		last = uint64(q.last)
+	}
+	return first, last, first <= last
+}
+
+// floatRange returns the equivalent float range
+func (q *intRangeQuery) floatRange() *floatRangeQuery {
+	first, last := float64(q.first), float64(q.last)
+	if q.first == minInt {
+		first = math.Inf(-1)
+	}
+	if q.last == maxInt {
+		last = math.Inf(1)
+	}
+	return &floatRangeQuery{q.field, first, last}
+}
+
+// parseFloat parses a number. Unlike strconv.ParseFloat, it doesn't accept
+// NaN or infinities (so strings like "Info" don't look like numbers).
+func parseFloat(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// isFloatType returns true for float fields (or slices of, or pointers to,
+// floats)
+func isFloatType(t reflect.Type) bool {
+	k := baseType(t).Kind()
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+// isUnsignedType returns true for unsigned int fields (or slices of, or
+// pointers to, them)
+func isUnsignedType(t reflect.Type) bool {
+	switch baseType(t).Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// inclusive floating point range
+type floatRangeQuery struct {
+	field       string
+	first, last float64
+}
+
+func (q *floatRangeQuery) String() string {
+	return fmt.Sprintf("%s: [%g TO %g]", q.field, q.first, q.last)
+}
+
+func (q *floatRangeQuery) score(coll *Collection) (docScores, error) {
+	ids, err := q.perform(coll)
+	return zeroScores(ids), err
+}
+
+func (q *floatRangeQuery) perform(coll *Collection) (docSet, error) {
+	if idx, got := coll.rangeIndexes[strings.ToLower(q.field)]; got {
+		return idx.between(&idx.floats, floatKey(q.first), floatKey(q.last)), nil
+	}
+	return coll.find(q.field, func(foo string) bool {
+		v, ok := parseFloat(foo)
+		if !ok {
+			return false
+		}
+		return v >= q.first && v <= q.last
+	})
+}
@@ -25,6 +25,7 @@ const (
 	tokLSq
 	tokRSq
 	tokTo
+	tokCaret
 )
 
 // some single-rune tokens
@@ -37,6 +38,7 @@ var singles = map[rune]tokType{
 	'+': tokPlus,
 	'-': tokMinus,
 	'=': tokEquals,
+	'^': tokCaret,
 }
 
 type token struct {
@@ -62,6 +64,7 @@ func (tok token) String() string {
 		tokRParen: "rparen",
 		tokLSq:    "lsq",
 		tokRSq:    "rsq",
+		tokCaret:  "caret",
 	}
 	return fmt.Sprintf("%s[%s]", tokTypes[tok.typ], tok.val)
 }
@@ -155,7 +158,7 @@ func lexText(l *lexer) stateFn {
 			break
 		}
 		r := l.next()
-		if unicode.IsSpace(r) || strings.ContainsRune("():[]", r) {
+		if unicode.IsSpace(r) || strings.ContainsRune("():[]^", r) {
 			l.backup()
 			break
 		}
@@ -82,6 +82,19 @@ func TestLexer(t *testing.T) {
 				token{tokEOF, ""},
 			},
 		},
+		{
+			`title:cheese^3 "moon made"^0.5`, []token{
+				token{tokLit, "title"},
+				token{tokColon, ":"},
+				token{tokLit, "cheese"},
+				token{tokCaret, "^"},
+				token{tokLit, "3"},
+				token{tokQuoted, `"moon made"`},
+				token{tokCaret, "^"},
+				token{tokLit, "0.5"},
+				token{tokEOF, ""},
+			},
+		},
 	}
 
 	for _, data := range testData {
@@ -5,23 +5,30 @@ import (
 	//"labix.org/v2/mgo"
 	//"regexp"
 	"github.com/bcampbell/badger"
+	"strconv"
 	"strings"
 	//	"time"
 )
 
 type parser struct {
-	tokens []token
-	pos    int
+	tokens   []token
+	pos      int
+	synonyms SynonymFunc
 }
 
+// SynonymFunc returns the synonyms to search for along with term in a
+// field (eg Collection.Synonyms).
+type SynonymFunc func(field, term string) []string
+
 /*
 BNF syntax for query strings:
-expr ::= andOp | orOp | group | range | ["="] lit | field ":" expr | [boolmod] expr
+expr ::= andOp | orOp | group | range | ["="] lit | field ":" expr | [boolmod] expr | expr boost
 andOp ::= expr expr | expr "AND" expr
 orOp ::= expr "OR" expr
 notOp ::= "NOT" expr
 group ::= "(" expr ")"
 range ::= "[" [start] "TO" [end] "]"
+boost ::= "^" number
 
 lit ::= string | quotedstring | doublequotedstring
 
@@ -32,12 +39,26 @@ doublequotedstring ::= /"(.*?)"/
 */
 
 func Parse(q string, validFields []string, defaultField string) (badger.Query, error) {
+	return ParseWithSynonyms(q, validFields, defaultField, nil)
+}
+
+// ParseWithSynonyms is like Parse, but expands search terms (and quoted
+// phrases) with their synonyms, eg with "uk" => "united kingdom", "britain":
+//
+//	country:uk
+//
+// becomes
+//
+//	((country:uk OR country:"united kingdom") OR country:britain)
+//
+// Exact matches (eg "=uk") aren't expanded.
+func ParseWithSynonyms(q string, validFields []string, defaultField string, synonyms SynonymFunc) (badger.Query, error) {
 	lex := lex(q)
 	var tokens []token
 	for tok := range lex.tokens {
 		tokens = append(tokens, tok)
 	}
-	p := parser{tokens: tokens}
+	p := parser{tokens: tokens, synonyms: synonyms}
 	return p.parseExpr(defaultField, validFields)
 }
 
@@ -101,10 +122,10 @@ func (p *parser) parseExpr(defaultField string, validFields []string) (badger.Qu
 		}
 
 	case tokLit:
-		q = badger.NewContainsQuery(field, tok.val)
+		q = p.contains(field, tok.val)
 	case tokQuoted:
 		txt := string(tok.val[1 : len(tok.val)-1])
-		q = badger.NewContainsQuery(field, txt)
+		q = p.contains(field, txt)
 	case tokLSq:
 		p.backup()
 		start, end, err := p.parseRange()
@@ -126,6 +147,12 @@ func (p *parser) parseExpr(defaultField string, validFields []string) (badger.Qu
 		return nil, fmt.Errorf("unexpected: %s", tok)
 	}
 
+	// optional boost
+	q, err = p.parseBoost(q)
+	if err != nil {
+		return nil, err
+	}
+
 	//
 	if boolMod == tokMinus {
 		q = badger.NewNOTQuery(q)
@@ -159,6 +186,19 @@ func (p *parser) parseExpr(defaultField string, validFields []string) (badger.Qu
 	return badger.NewANDQuery(q, qr), nil
 }
 
+// contains returns a contains query for txt, OR-ed with contains queries
+// for any synonyms it has
+func (p *parser) contains(field, txt string) badger.Query {
+	q := badger.NewContainsQuery(field, txt)
+	if p.synonyms == nil {
+		return q
+	}
+	for _, syn := range p.synonyms(field, txt) {
+		q = badger.NewORQuery(q, badger.NewContainsQuery(field, syn))
+	}
+	return q
+}
+
 // parse (optional) boolean modifier
 func (p *parser) parseBoolMod() tokType {
 	tok := p.next()
@@ -169,6 +209,26 @@ func (p *parser) parseBoolMod() tokType {
 	return tokPlus
 }
 
+// parse (optional) boost, wrapping q in a boost query if there is one
+// BNF:
+//     boost ::= "^" number
+func (p *parser) parseBoost(q badger.Query) (badger.Query, error) {
+	tok := p.next()
+	if tok.typ != tokCaret {
+		p.backup()
+		return q, nil
+	}
+	tok = p.next()
+	if tok.typ != tokLit {
+		return nil, fmt.Errorf("expected boost after '^', got %s", tok)
+	}
+	boost, err := strconv.ParseFloat(tok.val, 64)
+	if err != nil || boost < 0 {
+		return nil, fmt.Errorf("bad boost '%s'", tok.val)
+	}
+	return badger.NewBoostQuery(q, boost), nil
+}
+
 // parse (optional) field specifier
 // [ lit ":" ]
 // returns field name or nil if not a field
@@ -226,7 +286,7 @@ func (p *parser) parseRange() (string, string, error) {
 	tok = p.next()
 	switch tok.typ {
 	case tokLit:
-		start = tok.val
+		start = p.parseRangeLit(tok)
 	case tokQuoted:
 		start = string(tok.val[1 : len(tok.val)-1])
 	case tokTo:
@@ -244,7 +304,7 @@ func (p *parser) parseRange() (string, string, error) {
 	tok = p.next()
 	switch tok.typ {
 	case tokLit:
-		end = tok.val
+		end = p.parseRangeLit(tok)
 	case tokQuoted:
 		end = string(tok.val[1 : len(tok.val)-1])
 	case tokRSq:
@@ -264,3 +324,21 @@ func (p *parser) parseRange() (string, string, error) {
 
 	return start, end, nil
 }
+
+// parseRangeLit returns the value of an unquoted range bound.
+// Colons don't mean anything else inside a range, so they're glued back
+// on to allow times (eg 2010-06-14T10:20:00+01:00).
+func (p *parser) parseRangeLit(tok token) string {
+	val := tok.val
+	for p.peek().typ == tokColon {
+		p.next()
+		tok = p.next()
+		if tok.typ != tokLit {
+			p.backup()
+			p.backup()
+			break
+		}
+		val += ":" + tok.val
+	}
+	return val
+}
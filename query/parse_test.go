@@ -21,12 +21,16 @@ func TestBasic(t *testing.T) {
 		`published:[ 2010-02-01 TO 2010-04-15]`,
 		`published:[ TO 2010-04-15]`,
 		`published:[ 2010-04-15 TO]`,
+		`published:[ 2010-04-15T10:20:00Z TO 2010-04-16T09:00:00.5+01:00]`,
 		//`headline:(citrus -grapefruit)`,
 		//`published: ..2010-04-15`,
 		`headline:="blah blah blah"`,
 		`headline:(=foo OR =wibble)`,
 		"(fred bloggs) OR (bob smith)",
 		"red -black green blue",
+		"headline:cheese^3 tags:cheese",
+		`(lemon OR grapefruit)^2 headline:"citrus roundup"^1.5`,
+		`-tags:cheese^2 headline:=moon^4`,
 	}
 
 	for _, qs := range testQueries {
@@ -40,4 +44,17 @@ func TestBasic(t *testing.T) {
 		//		fmt.Println(DumpTree(q, 0))
 
 	}
+
+	// and some which shouldn't parse
+	badQueries := []string{
+		"headline:cheese^",
+		"headline:cheese^wibble",
+		"headline:cheese^-1",
+	}
+	for _, qs := range badQueries {
+		_, err := Parse(qs, []string{"headline"}, "headline")
+		if err == nil {
+			t.Errorf(`Parse(%s) should have failed`, qs)
+		}
+	}
 }
@@ -3,6 +3,7 @@ package query
 import (
 	//	"fmt"
 	"github.com/bcampbell/badger"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -62,6 +63,10 @@ func TestQueries(t *testing.T) {
 		{"tags:(cheese AND moon)", "1"},
 		{"date:[2010-06-14 TO]", "1,2"},   // >=
 		{"date:[TO 2010-06-14]", "1,2,5"}, // <=
+		{"date:[2010-06-14T10:00:00Z TO]", "2"},
+		{"date:[TO 2010-06-14T10:00:00+01:00]", "1,5"},
+		{"date:[2010-06-14T09:00:00-01:00 TO 2010-06-14T10:20:00Z]", "2"},
+		{`date:["2010-06-14T10:20:01Z" TO 2011-01-01]`, ""},
 		// tests to exercise whole-term matching
 		{"content:grape", "3"},
 		{"content:grapefruit", "2,4"},
@@ -92,6 +97,8 @@ func TestQueries(t *testing.T) {
 		for _, doc := range matches {
 			ids = append(ids, doc.ID)
 		}
+		// Find doesn't guarantee any order
+		sort.Strings(ids)
 		got := strings.Join(ids, ",")
 		if test.expect != got {
 			t.Errorf(`Query error (%q) got %q, expected %q`, test.q, got, test.expect)
@@ -99,3 +106,68 @@ func TestQueries(t *testing.T) {
 	}
 
 }
+
+func TestBoostedQuery(t *testing.T) {
+	coll := badger.NewCollection(&TestDoc{})
+	coll.Put(&TestDoc{ID: "1", Title: "Cheese", Content: "All about dairy."})
+	coll.Put(&TestDoc{ID: "2", Title: "Dairy", Content: "All about cheese."})
+
+	for _, test := range []struct{ q, expect string }{
+		{"title:cheese^3 OR content:cheese", "1,2"},
+		{"title:cheese OR content:cheese^3", "2,1"},
+	} {
+		q, err := Parse(test.q, coll.ValidFields(), "title")
+		if err != nil {
+			t.Fatal(err)
+		}
+		scored, _, err := coll.FindScored(q, badger.FindOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, sd := range scored {
+			ids = append(ids, sd.Doc.(*TestDoc).ID)
+		}
+		got := strings.Join(ids, ",")
+		if got != test.expect {
+			t.Errorf(`%q: got %q, expected %q`, test.q, got, test.expect)
+		}
+	}
+}
+
+func TestSynonymQuery(t *testing.T) {
+	coll := badger.NewCollection(&TestDoc{})
+	coll.SetWholeWordField("Content")
+	coll.Put(&TestDoc{ID: "1", Content: "Rain in the United Kingdom"})
+	coll.Put(&TestDoc{ID: "2", Content: "Rain in Britain"})
+	coll.Put(&TestDoc{ID: "3", Content: "Rain in the UK"})
+	coll.Put(&TestDoc{ID: "4", Content: "Rain in the kingdom of Fife"})
+	coll.SetSynonyms("content", badger.Synonyms{"uk": {"united kingdom", "britain"}})
+	coll.SetSynonyms("", badger.Synonyms{"downpour": {"rain"}})
+
+	for _, test := range []struct{ q, str, expect string }{
+		{"content:uk", `((content:uk OR content:"united kingdom") OR content:britain)`, "1,2,3"},
+		{`content:"uk"`, `((content:uk OR content:"united kingdom") OR content:britain)`, "1,2,3"},
+		{"content:downpour -content:uk", `((content:downpour OR content:rain) AND -((content:uk OR content:"united kingdom") OR content:britain))`, "4"},
+		{"content:kingdom", `content:kingdom`, "1,4"},
+		{"content:=uk", `content:=uk`, ""},
+	} {
+		q, err := ParseWithSynonyms(test.q, coll.ValidFields(), "content", coll.Synonyms)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.String() != test.str {
+			t.Errorf("%q: got %s, expected %s", test.q, q, test.str)
+		}
+		var matches []*TestDoc
+		coll.Find(q, &matches)
+		ids := []string{}
+		for _, doc := range matches {
+			ids = append(ids, doc.ID)
+		}
+		sort.Strings(ids)
+		if got := strings.Join(ids, ","); got != test.expect {
+			t.Errorf(`%q: got %q, expected %q`, test.q, got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package badger
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// rangeIndex keeps the values of a field in sorted order, so range queries
+// can find matching docs with a binary search instead of a scan.
+// Values are kept in several forms, one for each kind of range query:
+// plain (lowercased, and maybe folded) strings, integers, floats, dates and times.
+// Unsigned fields keep their integers in uints instead of ints, as they
+// might not fit in an int.
+type rangeIndex struct {
+	field    *fieldPath
+	fold     bool
+	unsigned bool
+	strs     keyList
+	ints     keyList
+	uints    keyList
+	floats   keyList
+	dates    keyList
+	times    keyList
+
+	// Each time a doc is added it gets a new generation number. Entries
+	// with an out-of-date generation are stale and are ignored (and
+	// discarded once there are enough of them).
+	gens    map[uintptr]uint64
+	nextGen uint64
+	// number of docs removed since the lists were last compacted
+	stale int
+
+	// lookups are performed with the collection only read-locked, so
+	// the lazy merging needs it's own lock.
+	mu sync.Mutex
+}
+
+type rangeEntry struct {
+	key string
+	id  uintptr
+	gen uint64
+}
+
+// keyList is a list of entries sorted by key.
+// New entries are collected in pending, and only merged in once there are
+// enough of them to be worth it. Until then, lookups check pending one by
+// one.
+type keyList struct {
+	entries []rangeEntry
+	pending []rangeEntry
+}
+
+func newRangeIndex(field *fieldPath, fold bool) *rangeIndex {
+	return &rangeIndex{
+		field:    field,
+		fold:     fold,
+		unsigned: isUnsignedType(field.Type),
+		gens:     make(map[uintptr]uint64),
+	}
+}
+
+// intKey encodes an int as a string which sorts in numeric order
+func intKey(n int) string {
+	return uintKey(uint64(n) ^ (1 << 63))
+}
+
+// uintKey encodes a uint64 as a string which sorts in numeric order
+func uintKey(u uint64) string {
+	var buf [8]byte
+	for i := 7; i >= 0; i-- {
+		buf[i] = byte(u)
+		u >>= 8
+	}
+	return string(buf[:])
+}
+
+func (idx *rangeIndex) add(id uintptr, doc interface{}) {
+	idx.nextGen++
+	gen := idx.nextGen
+	idx.gens[id] = gen
+	for _, val := range idx.field.docStrings(doc) {
+		idx.strs.add(rangeEntry{normalise(val, idx.fold), id, gen})
+		if idx.unsigned {
+			if n, err := strconv.ParseUint(val, 10, 64); err == nil {
+				idx.uints.add(rangeEntry{uintKey(n), id, gen})
+			}
+		} else if n, err := strconv.Atoi(val); err == nil {
+			idx.ints.add(rangeEntry{intKey(n), id, gen})
+		}
+		if f, ok := parseFloat(val); ok {
+			idx.floats.add(rangeEntry{floatKey(f), id, gen})
+		}
+		if date := dateExtractPat.FindString(val); date != "" {
+			idx.dates.add(rangeEntry{date, id, gen})
+		}
+		if t, ok := parseTime(val); ok {
+			idx.times.add(rangeEntry{timeKey(t), id, gen})
+		}
+	}
+}
+
+func (idx *rangeIndex) remove(id uintptr) {
+	// the doc's entries are now stale
+	delete(idx.gens, id)
+	idx.stale++
+	if idx.stale > len(idx.gens) {
+		// more dead docs than live ones - worth clearing them out
+		for _, l := range idx.lists() {
+			l.discardStale(idx.valid)
+		}
+		idx.stale = 0
+	}
+}
+
+func (idx *rangeIndex) lists() []*keyList {
+	return []*keyList{&idx.strs, &idx.ints, &idx.uints, &idx.floats, &idx.dates, &idx.times}
+}
+
+func (idx *rangeIndex) valid(e *rangeEntry) bool {
+	gen, got := idx.gens[e.id]
+	return got && gen == e.gen
+}
+
+// between returns the docs with a key in the inclusive range [first,last]
+func (idx *rangeIndex) between(l *keyList, first, last string) docSet {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	// Merging costs O(len(entries)), checking pending one by one costs
+	// O(len(pending)) per lookup. Merging once pending gets past
+	// sqrt(len(entries)) keeps both down to O(sqrt(n)) per write.
+	if len(l.pending)*len(l.pending) > len(l.entries) {
+		l.merge()
+	}
+
+	matching := docSet{}
+	i := sort.Search(len(l.entries), func(i int) bool {
+		return l.entries[i].key >= first
+	})
+	for ; i < len(l.entries) && l.entries[i].key <= last; i++ {
+		e := &l.entries[i]
+		if idx.valid(e) {
+			matching[e.id] = struct{}{}
+		}
+	}
+	for i, _ := range l.pending {
+		e := &l.pending[i]
+		if e.key >= first && e.key <= last && idx.valid(e) {
+			matching[e.id] = struct{}{}
+		}
+	}
+	return matching
+}
+
+func (l *keyList) add(e rangeEntry) {
+	l.pending = append(l.pending, e)
+	// (without any lookups, pending would just keep growing. Merging
+	// whenever it doubles the list keeps bulk loading cheap.)
+	if len(l.pending) > len(l.entries) {
+		l.merge()
+	}
+}
+
+// merge sorts the pending entries into the list. It works in place,
+// from the back, so the only allocation is when entries needs to grow.
+func (l *keyList) merge() {
+	if len(l.pending) == 0 {
+		return
+	}
+	sort.Slice(l.pending, func(i, j int) bool {
+		return l.pending[i].key < l.pending[j].key
+	})
+	i, j := len(l.entries)-1, len(l.pending)-1
+	l.entries = append(l.entries, l.pending...)
+	for k := len(l.entries) - 1; j >= 0; k-- {
+		if i >= 0 && l.entries[i].key > l.pending[j].key {
+			l.entries[k] = l.entries[i]
+			i--
+		} else {
+			l.entries[k] = l.pending[j]
+			j--
+		}
+	}
+	l.pending = l.pending[:0]
+}
+
+// discardStale removes stale entries from the list (in place)
+func (l *keyList) discardStale(valid func(*rangeEntry) bool) {
+	for _, entries := range []*[]rangeEntry{&l.entries, &l.pending} {
+		kept := (*entries)[:0]
+		for i, _ := range *entries {
+			if valid(&(*entries)[i]) {
+				kept = append(kept, (*entries)[i])
+			}
+		}
+		*entries = kept
+	}
+}
@@ -0,0 +1,169 @@
+package badger
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type EventDoc struct {
+	Name  string
+	Date  string
+	Count int
+	Tags  []string
+}
+
+func eventCollection(n int) *Collection {
+	coll := NewCollection(&EventDoc{})
+	for i := 0; i < n; i++ {
+		coll.Put(&EventDoc{
+			Name:  fmt.Sprintf("event %d", i),
+			Date:  fmt.Sprintf("%04d-%02d-%02dT12:00", 2000+i%20, 1+i%12, 1+i%28),
+			Count: (i * 7919) % 1000,
+			Tags:  []string{fmt.Sprintf("tag%d", i%10), fmt.Sprintf("%d", i%5)},
+		})
+	}
+	return coll
+}
+
+// check that range indexes give exactly the same results as a scan
+func TestRangeIndex(t *testing.T) {
+	coll := eventCollection(500)
+	coll.AddIndex("Date", RangeIndex)
+	coll.AddIndex("count", RangeIndex)
+	coll.AddIndex("Tags", RangeIndex)
+	coll.AddIndex("name", RangeIndex)
+
+	queries := []Query{
+		NewRangeQuery("date", "2005-01-01", "2006-06-30"),
+		NewRangeQuery("date", "", "2003-02-14"),
+		NewRangeQuery("date", "2018-12-01", ""),
+		NewRangeQuery("date", "2005", "2006"),
+		NewRangeQuery("count", "100", "200"),
+		NewRangeQuery("count", "", "-1"),
+		NewRangeQuery("count", "990", ""),
+		NewRangeQuery("count", "a", "b"),
+		NewRangeQuery("tags", "2", "3"),
+		NewRangeQuery("tags", "tag3", "tag5"),
+		NewRangeQuery("name", "event 1", "event 2"),
+		NewRangeQuery("name", "", "event 10"),
+	}
+
+	assertIndexParity(t, "after Put", coll, queries)
+
+	coll.Update(NewRangeQuery("count", "0", "500"), func(doc interface{}) {
+		ev := doc.(*EventDoc)
+		ev.Count += 250
+		ev.Date = "2017-07-07"
+	})
+	assertIndexParity(t, "after Update", coll, queries)
+
+	var evs []*EventDoc
+	coll.Find(NewRangeQuery("date", "2001-01-01", "2010-01-01"), &evs)
+	for _, ev := range evs {
+		coll.Remove(ev)
+	}
+	assertIndexParity(t, "after Remove", coll, queries)
+
+	// interleaved with lookups
+	for i := 0; i < 50; i++ {
+		coll.Put(&EventDoc{Name: fmt.Sprintf("late %d", i), Date: "2005-06-01", Count: 100 + i})
+		assertIndexParity(t, fmt.Sprintf("after late Put %d", i), coll, queries)
+	}
+
+	// stale entries mustn't pile up, even without any lookups
+	idx := coll.rangeIndexes["count"]
+	for i := 0; i < 10000; i++ {
+		coll.Update(NewExactQuery("name", "late 1"), func(doc interface{}) {
+			doc.(*EventDoc).Count++
+		})
+	}
+	if n := len(idx.ints.entries) + len(idx.ints.pending); n > 2*len(idx.gens) {
+		t.Errorf("%d entries for %d docs", n, len(idx.gens))
+	}
+	assertIndexParity(t, "after many updates", coll, queries)
+}
+
+type TimeDoc struct {
+	Name    string
+	When    time.Time
+	Expires *time.Time
+}
+
+func TestTimeFields(t *testing.T) {
+	est := time.FixedZone("EST", -5*60*60)
+	expires := time.Date(2011, 1, 1, 0, 0, 0, 0, time.UTC)
+	coll := NewCollection(&TimeDoc{})
+	coll.Put(&TimeDoc{Name: "a", When: time.Date(2010, 6, 14, 23, 30, 0, 0, est), Expires: &expires})
+	coll.Put(&TimeDoc{Name: "b", When: time.Date(2010, 6, 15, 1, 0, 0, 0, time.UTC)})
+	coll.Put(&TimeDoc{Name: "c", When: time.Date(2010, 6, 14, 12, 0, 0, 0, time.UTC)})
+	coll.Put(&TimeDoc{Name: "d"})
+
+	if got := strings.Join(coll.ValidFields(), ","); got != "Name,When,Expires" {
+		t.Errorf("ValidFields: got %s", got)
+	}
+
+	tests := []queryTest{
+		// plain dates are UTC days
+		{NewRangeQuery("when", "2010-06-14", "2010-06-14"), "c"},
+		{NewRangeQuery("when", "2010-06-15", ""), "a,b"},
+		// a is 04:30 UTC
+		{NewRangeQuery("when", "2010-06-15T04:30:00Z", ""), "a"},
+		{NewRangeQuery("when", "", "2010-06-14T23:00:00-05:00"), "b,c"},
+		{NewRangeQuery("when", "2010-06-14T12:00:00Z", "2010-06-15"), "a,b,c"},
+		{NewTimeRangeQuery("when", time.Time{}, time.Date(2010, 6, 14, 20, 0, 0, 0, est)), "b,c"},
+		{NewTimeRangeQuery("expires", expires, time.Time{}), "a"},
+		{NewRangeQuery("expires", "", "2012-01-01"), "a"},
+		{NewExactQuery("when", "2010-06-14T12:00:00Z"), "c"},
+		{NewExactQuery("when", "2010-06-15T04:30:00Z", "2010-06-15T01:00:00+00:00"), "a,b"},
+		{NewExactQuery("when", "2010-06-14T23:30:00-05:00"), "a"},
+		{NewExactQuery("when", "2010-06-14"), ""},
+	}
+
+	assertQueries(t, "unindexed", coll, "name", tests)
+	coll.AddIndex("when", RangeIndex)
+	coll.AddIndex("when", ExactIndex)
+	coll.AddIndex("expires", RangeIndex)
+	assertQueries(t, "indexed", coll, "name", tests)
+
+	// sorting is by time, not by timezone
+	var docs []*TimeDoc
+	coll.FindWithOptions(NewAllQuery(), &docs, FindOptions{Sort: []SortKey{{"when", Desc}}})
+	if docs[0].Name != "a" || docs[1].Name != "b" || docs[2].Name != "c" {
+		t.Errorf("time sort failed")
+	}
+}
+
+// benchmarkRangeQuery runs range queries, optionally with a Put (alternately
+// of a new doc and a changed one) before each query
+func benchmarkRangeQuery(b *testing.B, indexed bool, puts bool) {
+	coll := eventCollection(100000)
+	if indexed {
+		coll.AddIndex("date", RangeIndex)
+		coll.AddIndex("count", RangeIndex)
+	}
+	dateQ := NewRangeQuery("date", "2005-01-01", "2005-02-01")
+	countQ := NewRangeQuery("count", "100", "110")
+	var docs []*EventDoc
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if puts {
+			if i%2 == 0 {
+				doc := &EventDoc{Name: "new", Date: fmt.Sprintf("2005-01-%02d", 1+i%28), Count: i % 1000}
+				docs = append(docs, doc)
+				coll.Put(doc)
+			} else {
+				doc := docs[len(docs)-1]
+				doc.Count++
+				coll.Put(doc)
+			}
+		}
+		mustPerform(dateQ, coll)
+		mustPerform(countQ, coll)
+	}
+}
+
+func BenchmarkRangeQueryScan(b *testing.B)            { benchmarkRangeQuery(b, false, false) }
+func BenchmarkRangeQueryIndexed(b *testing.B)         { benchmarkRangeQuery(b, true, false) }
+func BenchmarkRangeQueryIndexedWithPuts(b *testing.B) { benchmarkRangeQuery(b, true, true) }
@@ -0,0 +1,183 @@
+package badger
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// docScores holds the docs matched by a query, along with how well
+// each one matched.
+type docScores map[uintptr]float64
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// ScoredDoc is a doc returned by FindScored, along with it's relevance score
+type ScoredDoc struct {
+	Doc   interface{}
+	Score float64
+}
+
+// zeroScores is for queries which match (or don't), but have no notion of
+// relevance - eg exact and range queries.
+func zeroScores(ids docSet) docScores {
+	scores := make(docScores, len(ids))
+	for id, _ := range ids {
+		scores[id] = 0
+	}
+	return scores
+}
+
+// textStats holds the numbers BM25 needs about the terms being searched
+// for in a field
+type textStats struct {
+	numDocs int
+	avgLen  float64
+	docLens map[uintptr]int
+	// number of docs containing each term
+	df map[string]int
+	// the number of times each term occurs in each doc
+	tf map[string]map[uintptr]int
+}
+
+// textStats gathers stats for terms in a field, using the inverted index
+// if there is one, otherwise by scanning all the docs.
+// If wholeWord is false, a token containing the term counts as an
+// occurrence (to match the way containsQuery matches non-whole-word
+// fields).
+func (coll *Collection) textStats(field string, terms []string, wholeWord bool) (*textStats, error) {
+	stats := &textStats{
+		numDocs: len(coll.docs),
+		df:      map[string]int{},
+		tf:      map[string]map[uintptr]int{},
+	}
+	if stats.numDocs == 0 {
+		return stats, nil
+	}
+
+	if idx, got := coll.wordIndexes[strings.ToLower(field)]; got && wholeWord {
+		stats.avgLen = float64(idx.totalLen) / float64(stats.numDocs)
+		stats.docLens = idx.docLens
+		for _, term := range terms {
+			postings := idx.postings[term]
+			stats.df[term] = len(postings)
+			tf := make(map[uintptr]int, len(postings))
+			for id, positions := range postings {
+				tf[id] = len(positions)
+			}
+			stats.tf[term] = tf
+		}
+		return stats, nil
+	}
+
+	fp, err := coll.queryField(field)
+	if err != nil {
+		return nil, err
+	}
+	for _, term := range terms {
+		stats.tf[term] = map[uintptr]int{}
+	}
+	stats.docLens = make(map[uintptr]int, stats.numDocs)
+	totalLen := 0
+	analyzer := coll.analyzer(field)
+	for id, doc := range coll.docs {
+		n := 0
+		for _, val := range fp.docStrings(doc) {
+			for _, tok := range analyzer.Analyze(val) {
+				n++
+				for _, term := range terms {
+					if tok.Term == term || (!wholeWord && strings.Contains(tok.Term, term)) {
+						stats.tf[term][id]++
+					}
+				}
+			}
+		}
+		stats.docLens[id] = n
+		totalLen += n
+	}
+	stats.avgLen = float64(totalLen) / float64(stats.numDocs)
+	for _, term := range terms {
+		stats.df[term] = len(stats.tf[term])
+	}
+	return stats, nil
+}
+
+// bm25 scores a doc against the terms
+func (stats *textStats) bm25(id uintptr, terms []string) float64 {
+	score := 0.0
+	dl := float64(stats.docLens[id])
+	norm := 1.0
+	if stats.avgLen > 0 {
+		norm = 1 - bm25B + bm25B*dl/stats.avgLen
+	}
+	for _, term := range terms {
+		tf := float64(stats.tf[term][id])
+		if tf == 0 {
+			continue
+		}
+		df := float64(stats.df[term])
+		idf := math.Log(1 + (float64(stats.numDocs)-df+0.5)/(df+0.5))
+		score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+	}
+	return score
+}
+
+// SetFieldBoost sets a weighting for text matches in a field when scoring,
+// eg to make hits in a title count for more than hits in the body text.
+// The default boost for a field is 1.
+func (coll *Collection) SetFieldBoost(fieldName string, boost float64) {
+	coll.Lock()
+	defer coll.Unlock()
+	coll.fieldBoosts[strings.ToLower(fieldName)] = boost
+}
+
+// fieldBoost returns the boost for a field (1 if none was set)
+func (coll *Collection) fieldBoost(field string) float64 {
+	if boost, got := coll.fieldBoosts[strings.ToLower(field)]; got {
+		return boost
+	}
+	return 1
+}
+
+// FindScored executes a query and returns the matching docs along with
+// relevance scores, best first.
+// Text searches (ie contains queries) are scored using BM25 (weighted by
+// SetFieldBoost and NewBoostQuery), and AND/OR queries sum the scores of
+// their subqueries. Other queries (exact,
+// range, NOT etc) only filter - they don't add to the score.
+// Any opts.Sort keys are used to order docs with equal scores.
+func (coll *Collection) FindScored(q Query, opts FindOptions) ([]ScoredDoc, FindInfo, error) {
+	coll.RLock()
+	defer coll.RUnlock()
+	scores, err := coll.score(q)
+	if err != nil {
+		return nil, FindInfo{}, err
+	}
+	ids := make(docSet, len(scores))
+	for id, _ := range scores {
+		ids[id] = struct{}{}
+	}
+	ordered, info, err := coll.order(ids, scores, &opts)
+	if err != nil {
+		return nil, info, err
+	}
+	out := make([]ScoredDoc, len(ordered))
+	for i, id := range ordered {
+		out[i] = ScoredDoc{coll.docs[id], scores[id]}
+	}
+	return out, info, nil
+}
+
+// score executes a scored query, adding some context to any error.
+// The caller must hold the collection lock.
+func (coll *Collection) score(q Query) (docScores, error) {
+	scores, err := q.score(coll)
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", q, err)
+	}
+	return scores, nil
+}
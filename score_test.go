@@ -0,0 +1,95 @@
+package badger
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFindScored(t *testing.T) {
+	docs := []*ArticleDoc{
+		&ArticleDoc{"Lemon", "Lemon lemon lemon. Grapefruit.", []string{"citrus"}},
+		&ArticleDoc{"Grapefruit", "All about grapefruit, with a passing mention of lemon at the end of a long and rambling article.", []string{"citrus"}},
+		&ArticleDoc{"Cheese", "Goes well with grape.", []string{"cheese"}},
+		&ArticleDoc{"Moon", "Made of cheese.", []string{"moon"}},
+	}
+	coll := AsTyped[ArticleDoc](NewCollection(&ArticleDoc{}))
+	for _, doc := range docs {
+		coll.Put(doc)
+	}
+
+	q := NewORQuery(NewContainsQuery("content", "lemon"), NewContainsQuery("content", "grapefruit"))
+	scored, info, err := coll.FindScored(q, FindOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scored) != 2 || info.Total != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(scored))
+	}
+	if scored[0].Doc != docs[0] || scored[0].Score <= scored[1].Score {
+		t.Errorf("expected lemon-heavy doc to score best (got %q %f, %q %f)",
+			scored[0].Doc.Title, scored[0].Score, scored[1].Doc.Title, scored[1].Score)
+	}
+
+	// AND sums scores, filters don't contribute
+	lemon, _, _ := coll.FindScored(NewContainsQuery("content", "lemon"), FindOptions{})
+	both, _, _ := coll.FindScored(NewANDQuery(NewContainsQuery("content", "lemon"), NewExactQuery("tags", "citrus")), FindOptions{})
+	if len(both) != len(lemon) || both[0].Score != lemon[0].Score {
+		t.Error("exact query shouldn't change the score")
+	}
+
+	// non-text queries score zero, but still match
+	all, _, _ := coll.FindScored(NewAllQuery(), FindOptions{Sort: []SortKey{{"title", Asc}}})
+	if len(all) != 4 || all[0].Score != 0 || all[0].Doc.Title != "Cheese" {
+		t.Error("unscored query failed")
+	}
+
+	// index should give the same scores as a scan
+	before, _, _ := coll.FindScored(q, FindOptions{})
+	coll.SetWholeWordField("content")
+	after, _, _ := coll.FindScored(q, FindOptions{})
+	var scan []Scored[ArticleDoc]
+	withoutIndexes(coll.Collection, func() { scan, _, _ = coll.FindScored(q, FindOptions{}) })
+	if len(after) != len(scan) {
+		t.Fatalf("index and scan disagree")
+	}
+	for i, _ := range after {
+		if after[i].Doc != scan[i].Doc || math.Abs(after[i].Score-scan[i].Score) > 1e-9 {
+			t.Errorf("index and scan scores differ: %f vs %f", after[i].Score, scan[i].Score)
+		}
+	}
+	if len(before) != len(after) {
+		t.Errorf("whole-word matching changed results")
+	}
+}
+
+func TestBoost(t *testing.T) {
+	coll := AsTyped[ArticleDoc](NewCollection(&ArticleDoc{}))
+	titleHit := &ArticleDoc{"Cheese", "All about dairy.", nil}
+	contentHit := &ArticleDoc{"Dairy", "All about cheese.", nil}
+	coll.Put(titleHit)
+	coll.Put(contentHit)
+	coll.Put(&ArticleDoc{"Moon", "Not made of anything much.", nil})
+
+	q := NewORQuery(NewContainsQuery("title", "cheese"), NewContainsQuery("content", "cheese"))
+	plain, _, _ := coll.FindScored(q, FindOptions{})
+	if len(plain) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(plain))
+	}
+
+	boosted, _, _ := coll.FindScored(NewORQuery(NewBoostQuery(NewContainsQuery("title", "cheese"), 3), NewContainsQuery("content", "cheese")), FindOptions{})
+	titleScore := 0.0
+	for _, sd := range plain {
+		if sd.Doc == titleHit {
+			titleScore = sd.Score
+		}
+	}
+	if boosted[0].Doc != titleHit || math.Abs(boosted[0].Score-3*titleScore) > 1e-9 {
+		t.Errorf("query boost failed")
+	}
+
+	coll.SetFieldBoost("Content", 10)
+	weighted, _, _ := coll.FindScored(q, FindOptions{})
+	if weighted[0].Doc != contentHit {
+		t.Errorf("field boost failed")
+	}
+}
@@ -0,0 +1,221 @@
+package badger
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// Snapshot format:
+// The file starts with snapshotMagic, followed by a big-endian uint16
+// holding the format version. The rest depends on the version.
+//
+// Version 1:
+// a gob stream containing a snapshotHeader, followed by
+// snapshotHeader.NumDocs documents.
+//
+// Version 2:
+// as version 1, but each document is preceded by it's key in the
+// collection (a uint64). Load() doesn't need them, but the write-ahead
+// log refers to docs by key.
+//
+// Fields can be added to snapshotHeader without bumping the version - gob
+// leaves them zeroed when reading older snapshots.
+//
+// Documents are stored with encoding/gob, so only exported fields are saved.
+// If the format changes, bump snapshotVersion and keep a loader for the
+// old version(s) around so old snapshots can still be read.
+const snapshotMagic = "badger"
+const snapshotVersion = 2
+
+type snapshotHeader struct {
+	DefaultField    string
+	KeyField        string
+	WholeWordFields []string
+	Indexes         []snapshotIndex
+	FieldBoosts     map[string]float64
+	NumDocs         int
+	Fold            bool
+	Synonyms        map[string]Synonyms
+}
+
+type snapshotIndex struct {
+	Field string
+	Type  IndexType
+}
+
+// Save writes a snapshot of the collection - all the documents, plus
+// settings such as DefaultField, whole-word fields, field boosts, folding,
+// synonyms and indexes - to w.
+// Use Load to read it back in.
+func (coll *Collection) Save(w io.Writer) error {
+	coll.RLock()
+	defer coll.RUnlock()
+	return coll.save(w)
+}
+
+// save writes out a snapshot. The caller must hold the collection lock.
+func (coll *Collection) save(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	if _, err := out.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(out, binary.BigEndian, uint16(snapshotVersion)); err != nil {
+		return err
+	}
+
+	hdr := snapshotHeader{
+		DefaultField:    coll.DefaultField,
+		WholeWordFields: []string{},
+		Indexes:         []snapshotIndex{},
+		FieldBoosts:     coll.fieldBoosts,
+		NumDocs:         len(coll.docs),
+		Fold:            coll.fold,
+		Synonyms:        coll.synonyms,
+	}
+	if coll.primary != nil {
+		hdr.KeyField = coll.primary.field.Name
+	}
+	for field, _ := range coll.wholeWordFields {
+		hdr.WholeWordFields = append(hdr.WholeWordFields, field)
+	}
+	sort.Strings(hdr.WholeWordFields)
+	for field, _ := range coll.rangeIndexes {
+		hdr.Indexes = append(hdr.Indexes, snapshotIndex{field, RangeIndex})
+	}
+	for field, _ := range coll.exactIndexes {
+		hdr.Indexes = append(hdr.Indexes, snapshotIndex{field, ExactIndex})
+	}
+
+	enc := gob.NewEncoder(out)
+	if err := enc.Encode(&hdr); err != nil {
+		return err
+	}
+	for key, doc := range coll.docs {
+		if err := enc.Encode(uint64(key)); err != nil {
+			return err
+		}
+		if err := enc.Encode(doc); err != nil {
+			return fmt.Errorf("encoding doc: %s", err)
+		}
+	}
+	return out.Flush()
+}
+
+// Load reads a snapshot written by Collection.Save, and returns a new
+// collection holding the saved documents and settings.
+// As with NewCollection, referenceDoc gives the type of the documents.
+func Load(r io.Reader, referenceDoc interface{}) (*Collection, error) {
+	coll, _, err := load(r, referenceDoc)
+	return coll, err
+}
+
+// load reads in a snapshot, returning the new collection along with the
+// docs mapped by the keys they were saved under (if the snapshot has them).
+func load(r io.Reader, referenceDoc interface{}) (*Collection, map[uint64]interface{}, error) {
+	in := bufio.NewReader(r)
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(in, magic); err != nil {
+		return nil, nil, fmt.Errorf("reading snapshot header: %s", err)
+	}
+	if string(magic) != snapshotMagic {
+		return nil, nil, fmt.Errorf("not a snapshot")
+	}
+	var version uint16
+	if err := binary.Read(in, binary.BigEndian, &version); err != nil {
+		return nil, nil, fmt.Errorf("reading snapshot header: %s", err)
+	}
+
+	switch version {
+	case 1:
+		coll, err := loadV1(in, referenceDoc)
+		return coll, map[uint64]interface{}{}, err
+	case 2:
+		return loadV2(in, referenceDoc)
+	default:
+		return nil, nil, fmt.Errorf("unsupported snapshot version (%d)", version)
+	}
+}
+
+func loadV1(in io.Reader, referenceDoc interface{}) (*Collection, error) {
+	coll, dec, hdr, err := loadHeader(in, referenceDoc)
+	if err != nil {
+		return nil, err
+	}
+	elemType := coll.docType.Elem()
+	for i := 0; i < hdr.NumDocs; i++ {
+		doc := reflect.New(elemType).Interface()
+		if err := dec.Decode(doc); err != nil {
+			return nil, fmt.Errorf("reading doc %d of %d: %s", i+1, hdr.NumDocs, err)
+		}
+		coll.Put(doc)
+	}
+	coll.dirty = false
+	return coll, nil
+}
+
+func loadV2(in io.Reader, referenceDoc interface{}) (*Collection, map[uint64]interface{}, error) {
+	coll, dec, hdr, err := loadHeader(in, referenceDoc)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := make(map[uint64]interface{}, hdr.NumDocs)
+	elemType := coll.docType.Elem()
+	for i := 0; i < hdr.NumDocs; i++ {
+		var key uint64
+		if err := dec.Decode(&key); err != nil {
+			return nil, nil, fmt.Errorf("reading doc %d of %d: %s", i+1, hdr.NumDocs, err)
+		}
+		doc := reflect.New(elemType).Interface()
+		if err := dec.Decode(doc); err != nil {
+			return nil, nil, fmt.Errorf("reading doc %d of %d: %s", i+1, hdr.NumDocs, err)
+		}
+		coll.Put(doc)
+		keys[key] = doc
+	}
+	coll.dirty = false
+	return coll, keys, nil
+}
+
+// loadHeader creates a collection with the settings from a snapshot header,
+// ready for the docs to be read in.
+func loadHeader(in io.Reader, referenceDoc interface{}) (*Collection, *gob.Decoder, *snapshotHeader, error) {
+	coll := NewCollection(referenceDoc)
+
+	dec := gob.NewDecoder(in)
+	var hdr snapshotHeader
+	if err := dec.Decode(&hdr); err != nil {
+		return nil, nil, nil, fmt.Errorf("reading snapshot header: %s", err)
+	}
+
+	if hdr.KeyField != "" {
+		fp, ok := coll.resolveField(hdr.KeyField)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("snapshot has unknown key field '%s'", hdr.KeyField)
+		}
+		coll.primary = newKeyIndex(fp)
+	}
+	coll.DefaultField = hdr.DefaultField
+	coll.SetFolding(hdr.Fold)
+	for _, field := range hdr.WholeWordFields {
+		coll.SetWholeWordField(field)
+	}
+	for field, boost := range hdr.FieldBoosts {
+		coll.SetFieldBoost(field, boost)
+	}
+	for field, syn := range hdr.Synonyms {
+		coll.SetSynonyms(field, syn)
+	}
+	for _, idx := range hdr.Indexes {
+		if _, ok := coll.resolveField(idx.Field); !ok {
+			return nil, nil, nil, fmt.Errorf("snapshot has index on unknown field '%s'", idx.Field)
+		}
+		coll.AddIndex(idx.Field, idx.Type)
+	}
+	return coll, dec, &hdr, nil
+}
@@ -0,0 +1,204 @@
+package badger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	coll := eventCollection(100)
+	coll.DefaultField = "name"
+	coll.SetWholeWordField("Name")
+	coll.AddIndex("date", RangeIndex)
+	coll.AddIndex("tags", ExactIndex)
+	coll.SetFolding(true)
+	coll.SetSynonyms("name", Synonyms{"event": {"happening"}})
+
+	var buf bytes.Buffer
+	if err := coll.Save(&buf); err != nil {
+		t.Fatalf("Save failed: %s", err)
+	}
+
+	loaded, err := Load(&buf, &EventDoc{})
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+
+	if loaded.Count() != coll.Count() {
+		t.Errorf("Count mismatch: got %d, expected %d", loaded.Count(), coll.Count())
+	}
+	if loaded.DefaultField != "name" {
+		t.Errorf("DefaultField not restored (got %q)", loaded.DefaultField)
+	}
+	if _, got := loaded.wordIndexes["name"]; !got {
+		t.Error("whole-word field not restored")
+	}
+	if _, got := loaded.rangeIndexes["date"]; !got {
+		t.Error("range index not restored")
+	}
+	if _, got := loaded.exactIndexes["tags"]; !got {
+		t.Error("exact index not restored")
+	}
+	if !loaded.fold {
+		t.Error("folding not restored")
+	}
+	if syn := loaded.Synonyms("name", "event"); len(syn) != 1 {
+		t.Errorf("synonyms not restored (got %v)", syn)
+	}
+
+	queries := []Query{
+		NewContainsQuery("name", "event 4"),
+		NewRangeQuery("date", "2005-01-01", "2010-01-01"),
+		NewExactQuery("tags", "tag3"),
+		NewRangeQuery("count", "100", "300"),
+	}
+	for _, q := range queries {
+		var expect, got []*EventDoc
+		coll.Find(q, &expect)
+		loaded.Find(q, &got)
+		if len(expect) != len(got) {
+			t.Errorf("%s: got %d matches, expected %d", q, len(got), len(expect))
+		}
+	}
+}
+
+func TestSnapshotBadInput(t *testing.T) {
+	inputs := []string{
+		"",
+		"not a snapshot at all",
+		"badger\x00\x63blahblahblah",
+		"badger\x00\x01blahblahblah",
+	}
+	for _, in := range inputs {
+		_, err := Load(bytes.NewBufferString(in), &EventDoc{})
+		if err == nil {
+			t.Errorf("Load(%q) didn't fail", in)
+		}
+	}
+}
+
+func TestSnapshotKeyed(t *testing.T) {
+	coll := NewCollectionWithKey(&EventDoc{}, "Name")
+	coll.Put(&EventDoc{Name: "one", Count: 1})
+	coll.Put(&EventDoc{Name: "two", Count: 2})
+
+	var buf bytes.Buffer
+	if err := coll.Save(&buf); err != nil {
+		t.Fatalf("Save failed: %s", err)
+	}
+	loaded, err := Load(&buf, &EventDoc{})
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	doc, ok := loaded.Get("two").(*EventDoc)
+	if !ok || doc.Count != 2 {
+		t.Errorf("Get after Load failed: got %v", doc)
+	}
+	loaded.Put(&EventDoc{Name: "one", Count: 11})
+	if loaded.Count() != 2 {
+		t.Errorf("upsert after Load failed")
+	}
+}
+
+// writeV1Snapshot writes docs out in the version 1 snapshot layout (a
+// header without keys, followed by the bare docs)
+func writeV1Snapshot(w io.Writer, docs []*EventDoc) error {
+	type v1Header struct {
+		DefaultField    string
+		WholeWordFields []string
+		Indexes         []snapshotIndex
+		NumDocs         int
+	}
+	if _, err := io.WriteString(w, snapshotMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(1)); err != nil {
+		return err
+	}
+	enc := gob.NewEncoder(w)
+	hdr := v1Header{
+		DefaultField:    "name",
+		WholeWordFields: []string{"name"},
+		Indexes:         []snapshotIndex{{"count", RangeIndex}},
+		NumDocs:         len(docs),
+	}
+	if err := enc.Encode(&hdr); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSnapshotV1(t *testing.T) {
+	docs := []*EventDoc{
+		{Name: "one", Date: "2001-01-01", Count: 1},
+		{Name: "two", Date: "2002-02-02", Count: 2},
+		{Name: "three", Date: "2003-03-03", Count: 3},
+	}
+	check := func(when string, coll *Collection) {
+		if coll.Count() != len(docs) {
+			t.Errorf("%s: got %d docs, expected %d", when, coll.Count(), len(docs))
+		}
+		if coll.DefaultField != "name" {
+			t.Errorf("%s: DefaultField not restored (got %q)", when, coll.DefaultField)
+		}
+		if _, got := coll.wordIndexes["name"]; !got {
+			t.Errorf("%s: whole-word field not restored", when)
+		}
+		if _, got := coll.rangeIndexes["count"]; !got {
+			t.Errorf("%s: range index not restored", when)
+		}
+		var out []*EventDoc
+		coll.Find(NewRangeQuery("count", "2", "3"), &out)
+		if len(out) != 2 {
+			t.Errorf("%s: range query got %d docs, expected 2", when, len(out))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeV1Snapshot(&buf, docs); err != nil {
+		t.Fatal(err)
+	}
+	coll, err := Load(&buf, &EventDoc{})
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	check("Load", coll)
+
+	// a logged collection with an old snapshot (and no log)
+	dir := t.TempDir()
+	f, err := os.Create(snapshotPath(dir, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeV1Snapshot(f, docs)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	coll, err = OpenLogged(dir, &EventDoc{}, LogOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("OpenLogged failed: %s", err)
+	}
+	check("OpenLogged", coll)
+	coll.Put(&EventDoc{Name: "four", Count: 4})
+	coll.Close()
+
+	// should have been upgraded on open
+	coll, err = OpenLogged(dir, &EventDoc{}, LogOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("reopen failed: %s", err)
+	}
+	defer coll.Close()
+	if coll.Count() != len(docs)+1 {
+		t.Errorf("after reopen: got %d docs, expected %d", coll.Count(), len(docs)+1)
+	}
+}
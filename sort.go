@@ -0,0 +1,357 @@
+package badger
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SortOrder is the direction to sort results in
+type SortOrder int
+
+const (
+	Asc SortOrder = iota
+	Desc
+)
+
+// SortKey specifies a field to sort results by
+type SortKey struct {
+	Field string
+	Order SortOrder
+}
+
+// FindOptions holds optional extras for Collection.FindWithOptions
+type FindOptions struct {
+	// Sort lists the fields to order the results by. Later keys are
+	// used to break ties in earlier ones.
+	// Values are compared the same way range queries treat them - numbers
+	// numerically, date-like strings (containing YYYY-MM-DD) by date,
+	// everything else as case-insensitive strings. For []string fields,
+	// the lowest value is used for Asc, the highest for Desc.
+	// Docs with an empty value always sort last.
+	// Any remaining ties are broken by primary key (if the collection has
+	// one), so the order is always deterministic.
+	Sort []SortKey
+
+	// Offset skips the first Offset results
+	Offset int
+	// Limit is the maximum number of results to return (0 for no limit)
+	Limit int
+	// After resumes from a cursor returned in FindInfo.Next, returning only
+	// results after it. Offset applies from the cursor onward.
+	// The same Sort options must be used.
+	After string
+}
+
+// FindInfo holds extra details about the results of FindWithOptions
+type FindInfo struct {
+	// Total is the number of docs matching the query, regardless of
+	// Offset, Limit or After.
+	Total int
+	// Next is a cursor which can be passed in as FindOptions.After to get
+	// the next page of results. It is empty if there are no more.
+	Next string
+}
+
+// sortKey encodes a value as a string which sorts appropriately:
+// numbers first (in numeric order), then dates, then other strings.
+func sortKey(val string) string {
+	if n, err := strconv.Atoi(val); err == nil {
+		// ints too big to hold exactly as floats still need to sort
+		// correctly, hence the intKey
+		return "0" + floatKey(float64(n)) + intKey(n)
+	}
+	if f, ok := parseFloat(val); ok {
+		return "0" + floatKey(f)
+	}
+	lower := strings.ToLower(val)
+	if date := dateExtractPat.FindString(val); date != "" {
+		return "1" + date + "\x00" + lower
+	}
+	return "2" + lower
+}
+
+// floatKey encodes a float64 as a string which sorts in numeric order
+func floatKey(f float64) string {
+	u := math.Float64bits(f)
+	if f >= 0 {
+		u ^= 1 << 63
+	} else {
+		u = ^u
+	}
+	var buf [8]byte
+	for i := 7; i >= 0; i-- {
+		buf[i] = byte(u)
+		u >>= 8
+	}
+	return string(buf[:])
+}
+
+// docSortKeys holds the sort keys for a single doc. Everything but the ID
+// gets encoded into a cursor.
+type docSortKeys struct {
+	ID   uintptr
+	Keys []string
+	// set if the doc has no value for the corresponding key
+	Missing []bool
+	// primary key, if the collection has one
+	PK string
+	// sequence number, for the final tie-break
+	Seq uint64
+}
+
+// sorter orders docs according to a set of SortKeys
+type sorter struct {
+	coll   *Collection
+	keys   []SortKey
+	fields []*fieldPath
+	// relevance scores, if ordering by score
+	scores docScores
+}
+
+// newSorter creates a sorter to order docs by keys.
+// If scores is non-nil, docs are ordered by score first (best first).
+func (coll *Collection) newSorter(keys []SortKey, scores docScores) (*sorter, error) {
+	if scores != nil {
+		keys = append([]SortKey{{"", Desc}}, keys...)
+	}
+	srt := &sorter{coll: coll, keys: keys, fields: make([]*fieldPath, len(keys)), scores: scores}
+	for i, k := range keys {
+		if scores != nil && i == 0 {
+			// the score, rather than a field
+			continue
+		}
+		fp, err := coll.queryField(k.Field)
+		if err != nil {
+			return nil, fmt.Errorf("sort: %w", err)
+		}
+		srt.fields[i] = fp
+	}
+	return srt, nil
+}
+
+// docKeys extracts the sort keys for a doc
+func (srt *sorter) docKeys(id uintptr) *docSortKeys {
+	doc := srt.coll.docs[id]
+	dk := &docSortKeys{ID: id, Keys: make([]string, len(srt.keys)), Missing: make([]bool, len(srt.keys))}
+	for i, k := range srt.keys {
+		if srt.fields[i] == nil {
+			dk.Keys[i] = floatKey(srt.scores[id])
+			continue
+		}
+		vals := srt.fields[i].docStrings(doc)
+		first := true
+		for _, val := range vals {
+			if val == "" {
+				continue
+			}
+			key := sortKey(val)
+			if first || (k.Order == Asc && key < dk.Keys[i]) || (k.Order == Desc && key > dk.Keys[i]) {
+				dk.Keys[i] = key
+			}
+			first = false
+		}
+		dk.Missing[i] = first
+	}
+	if srt.coll.primary != nil {
+		dk.PK = srt.coll.primary.keys[id]
+	}
+	dk.Seq = srt.coll.seqs[id]
+	return dk
+}
+
+// less returns true if doc a sorts before doc b
+func (srt *sorter) less(a, b *docSortKeys) bool {
+	for i, k := range srt.keys {
+		if a.Missing[i] != b.Missing[i] {
+			return b.Missing[i]
+		}
+		if a.Keys[i] == b.Keys[i] {
+			continue
+		}
+		if k.Order == Desc {
+			return a.Keys[i] > b.Keys[i]
+		}
+		return a.Keys[i] < b.Keys[i]
+	}
+	// tie break
+	if a.PK != b.PK {
+		return sortKey(a.PK) < sortKey(b.PK)
+	}
+	return a.Seq < b.Seq
+}
+
+// Cursors are handed out to clients, so they're kept simple and checked
+// carefully on the way back in. A cursor is the base64 encoding of:
+//
+//   for each sort key: a byte (1 if the doc has no value, else 0), then
+//                      the key, as a uvarint length followed by the bytes
+//   the primary key, in the same way ("" if the collection has none)
+//   the sequence number, as a uvarint
+
+func (srt *sorter) encodeCursor(dk *docSortKeys) string {
+	buf := []byte{}
+	for i, key := range dk.Keys {
+		missing := byte(0)
+		if dk.Missing[i] {
+			missing = 1
+		}
+		buf = append(buf, missing)
+		buf = binary.AppendUvarint(buf, uint64(len(key)))
+		buf = append(buf, key...)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(dk.PK)))
+	buf = append(buf, dk.PK...)
+	buf = binary.AppendUvarint(buf, dk.Seq)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func (srt *sorter) decodeCursor(cursor string) (*docSortKeys, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+	// uvarint reads a uvarint from the front of raw
+	uvarint := func() (uint64, bool) {
+		n, w := binary.Uvarint(raw)
+		if w <= 0 {
+			return 0, false
+		}
+		raw = raw[w:]
+		return n, true
+	}
+	// str reads a length-prefixed string from the front of raw
+	str := func() (string, bool) {
+		n, ok := uvarint()
+		if !ok || n > uint64(len(raw)) {
+			return "", false
+		}
+		s := string(raw[:n])
+		raw = raw[n:]
+		return s, true
+	}
+
+	dk := &docSortKeys{Keys: make([]string, len(srt.keys)), Missing: make([]bool, len(srt.keys))}
+	for i, _ := range srt.keys {
+		if len(raw) == 0 || raw[0] > 1 {
+			return nil, ErrBadCursor
+		}
+		dk.Missing[i] = raw[0] == 1
+		raw = raw[1:]
+		key, ok := str()
+		// keys are never empty, and missing values never have one
+		if !ok || dk.Missing[i] != (key == "") {
+			return nil, ErrBadCursor
+		}
+		// scores are floatKeys
+		if srt.fields[i] == nil && (dk.Missing[i] || len(key) != 8) {
+			return nil, ErrBadCursor
+		}
+		dk.Keys[i] = key
+	}
+	pk, ok := str()
+	if !ok || (srt.coll.primary == nil && pk != "") {
+		return nil, ErrBadCursor
+	}
+	dk.PK = pk
+	seq, ok := uvarint()
+	if !ok || seq >= srt.coll.nextSeq || len(raw) != 0 {
+		return nil, ErrBadCursor
+	}
+	dk.Seq = seq
+	return dk, nil
+}
+
+// sortHeap is a max-heap of docs (ie the doc which sorts last is on top)
+type sortHeap struct {
+	srt  *sorter
+	docs []*docSortKeys
+}
+
+func (h *sortHeap) Len() int           { return len(h.docs) }
+func (h *sortHeap) Less(i, j int) bool { return h.srt.less(h.docs[j], h.docs[i]) }
+func (h *sortHeap) Swap(i, j int)      { h.docs[i], h.docs[j] = h.docs[j], h.docs[i] }
+func (h *sortHeap) Push(x interface{}) { h.docs = append(h.docs, x.(*docSortKeys)) }
+func (h *sortHeap) Pop() interface{} {
+	n := len(h.docs)
+	dk := h.docs[n-1]
+	h.docs = h.docs[:n-1]
+	return dk
+}
+
+// order applies the sorting and paging options to the ids, returning the
+// ones to output, in order.
+// When a Limit is set, only the Offset+Limit best docs are kept while
+// sorting, rather than sorting everything.
+// If scores is non-nil, the docs are ordered by score before opts.Sort.
+// The caller must hold the collection lock.
+func (coll *Collection) order(ids docSet, scores docScores, opts *FindOptions) ([]uintptr, FindInfo, error) {
+	info := FindInfo{Total: len(ids)}
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return nil, info, fmt.Errorf("negative Offset or Limit")
+	}
+
+	if scores == nil && len(opts.Sort) == 0 && opts.Offset == 0 && opts.Limit == 0 && opts.After == "" {
+		// plain old unordered results
+		out := make([]uintptr, 0, len(ids))
+		for id, _ := range ids {
+			out = append(out, id)
+		}
+		return out, info, nil
+	}
+
+	// if paging without any Sort, we still need a consistent order, so
+	// the tie-break is used on it's own.
+	srt, err := coll.newSorter(opts.Sort, scores)
+	if err != nil {
+		return nil, info, err
+	}
+	var after *docSortKeys
+	if opts.After != "" {
+		after, err = srt.decodeCursor(opts.After)
+		if err != nil {
+			return nil, info, err
+		}
+	}
+
+	want := opts.Offset + opts.Limit
+	h := &sortHeap{srt: srt}
+	remaining := 0 // number of candidates (ie after the cursor)
+	for id, _ := range ids {
+		dk := srt.docKeys(id)
+		if after != nil && !srt.less(after, dk) {
+			continue
+		}
+		remaining++
+		if opts.Limit == 0 || len(h.docs) < want {
+			heap.Push(h, dk)
+		} else if srt.less(dk, h.docs[0]) {
+			h.docs[0] = dk
+			heap.Fix(h, 0)
+		}
+	}
+
+	sorted := h.docs
+	sort.Slice(sorted, func(i, j int) bool {
+		return srt.less(sorted[i], sorted[j])
+	})
+	if opts.Offset >= len(sorted) {
+		sorted = nil
+	} else {
+		sorted = sorted[opts.Offset:]
+	}
+
+	out := make([]uintptr, len(sorted))
+	for i, dk := range sorted {
+		out[i] = dk.ID
+	}
+	if opts.Limit > 0 && remaining > want && len(sorted) > 0 {
+		info.Next = srt.encodeCursor(sorted[len(sorted)-1])
+	}
+	return out, info, nil
+}
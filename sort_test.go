@@ -0,0 +1,164 @@
+package badger
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSort(t *testing.T) {
+	coll := NewTypedCollectionWithKey[EventDoc]("name")
+	for _, doc := range []*EventDoc{
+		&EventDoc{Name: "a", Date: "2010-06-14T10:20", Count: 10, Tags: []string{"pear", "apple"}},
+		&EventDoc{Name: "b", Date: "2010-06-14", Count: 9, Tags: []string{"Banana"}},
+		&EventDoc{Name: "c", Date: "1865-01-01", Count: 10, Tags: []string{}},
+		&EventDoc{Name: "d", Date: "", Count: -2, Tags: []string{"zucchini", "cherry"}},
+		&EventDoc{Name: "e", Date: "2011-01-01", Count: 100, Tags: []string{"apricot"}},
+	} {
+		coll.Put(doc)
+	}
+
+	tests := []struct {
+		sort   []SortKey
+		expect string
+	}{
+		{[]SortKey{{"Date", Asc}}, "c,b,a,e,d"},
+		{[]SortKey{{"Date", Desc}}, "e,a,b,c,d"},
+		{[]SortKey{{"Count", Asc}}, "d,b,a,c,e"},
+		{[]SortKey{{"count", Desc}, {"date", Asc}}, "e,c,a,b,d"},
+		{[]SortKey{{"count", Desc}, {"date", Desc}}, "e,a,c,b,d"},
+		{[]SortKey{{"Tags", Asc}}, "a,e,b,d,c"},
+		{[]SortKey{{"Tags", Desc}}, "d,a,b,e,c"},
+		{[]SortKey{{"name", Desc}}, "e,d,c,b,a"},
+	}
+
+	for _, test := range tests {
+		docs, _, err := coll.FindWithOptions(NewAllQuery(), FindOptions{Sort: test.sort})
+		if err != nil {
+			t.Errorf("%v: %s", test.sort, err)
+			continue
+		}
+		names := []string{}
+		for _, doc := range docs {
+			names = append(names, doc.Name)
+		}
+		got := strings.Join(names, ",")
+		if got != test.expect {
+			t.Errorf("%v: got %s, expected %s", test.sort, got, test.expect)
+		}
+	}
+
+	// ties broken deterministically
+	var out []*TestDoc
+	dummy := dummyCollection()
+	first := ""
+	for i := 0; i < 10; i++ {
+		if _, err := dummy.FindWithOptions(NewAllQuery(), &out, FindOptions{Sort: []SortKey{{"tags", Asc}}}); err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, doc := range out {
+			ids = append(ids, doc.ID)
+		}
+		got := strings.Join(ids, ",")
+		if first == "" {
+			first = got
+		} else if got != first {
+			t.Errorf("non-deterministic order: %s vs %s", got, first)
+		}
+	}
+
+	if _, _, err := coll.FindWithOptions(NewAllQuery(), FindOptions{Sort: []SortKey{{"wibble", Asc}}}); err == nil {
+		t.Error("sorting on unknown field should fail")
+	}
+}
+
+func TestPaging(t *testing.T) {
+	coll := AsTyped[EventDoc](eventCollection(95))
+
+	for _, sortKeys := range [][]SortKey{
+		nil,
+		[]SortKey{{"count", Asc}},
+		[]SortKey{{"date", Desc}, {"name", Asc}},
+	} {
+		all, info, err := coll.FindWithOptions(NewAllQuery(), FindOptions{Sort: sortKeys, Limit: 1000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 95 || info.Total != 95 || info.Next != "" {
+			t.Fatalf("%v: expected all 95 docs (got %d, total %d)", sortKeys, len(all), info.Total)
+		}
+
+		// offset/limit
+		for _, page := range []struct{ offset, limit, expect int }{
+			{0, 10, 10}, {20, 10, 10}, {90, 10, 5}, {95, 10, 0}, {200, 10, 0},
+		} {
+			docs, info, err := coll.FindWithOptions(NewAllQuery(), FindOptions{Sort: sortKeys, Offset: page.offset, Limit: page.limit})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(docs) != page.expect || info.Total != 95 {
+				t.Errorf("%v: offset %d: got %d docs (total %d), expected %d", sortKeys, page.offset, len(docs), info.Total, page.expect)
+				continue
+			}
+			for i, doc := range docs {
+				if doc != all[page.offset+i] {
+					t.Errorf("%v: offset %d: wrong doc at %d", sortKeys, page.offset, i)
+					break
+				}
+			}
+		}
+
+		// cursors
+		got := []*EventDoc{}
+		opts := FindOptions{Sort: sortKeys, Limit: 7}
+		for pages := 0; pages < 100; pages++ {
+			docs, info, err := coll.FindWithOptions(NewAllQuery(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, docs...)
+			if info.Next == "" {
+				break
+			}
+			opts.After = info.Next
+		}
+		if len(got) != len(all) {
+			t.Errorf("%v: paging with cursors got %d docs, expected %d", sortKeys, len(got), len(all))
+			continue
+		}
+		for i, _ := range got {
+			if got[i] != all[i] {
+				t.Errorf("%v: paging with cursors got wrong doc at %d", sortKeys, i)
+				break
+			}
+		}
+	}
+
+	sortKeys := []SortKey{{"date", Desc}, {"name", Asc}}
+	_, info, err := coll.FindWithOptions(NewAllQuery(), FindOptions{Sort: sortKeys, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(info.Next)
+	for _, bad := range []struct {
+		cursor string
+		sort   []SortKey
+	}{
+		{"garbage!", sortKeys},
+		{base64.RawURLEncoding.EncodeToString(raw[:len(raw)-1]), sortKeys},
+		{base64.RawURLEncoding.EncodeToString(append(raw, 0)), sortKeys},
+		{base64.RawURLEncoding.EncodeToString(append([]byte{2}, raw[1:]...)), sortKeys},
+		// huge length
+		{base64.RawURLEncoding.EncodeToString(append([]byte{0, 0xff, 0xff, 0xff, 0xff, 0x0f}, raw[2:]...)), sortKeys},
+		// doesn't match the sort options
+		{info.Next, []SortKey{{"date", Desc}}},
+		{info.Next, []SortKey{{"date", Desc}, {"name", Asc}, {"count", Asc}}},
+	} {
+		_, _, err := coll.FindWithOptions(NewAllQuery(), FindOptions{Sort: bad.sort, After: bad.cursor})
+		if !errors.Is(err, ErrBadCursor) {
+			t.Errorf("cursor %q (sort %v): expected ErrBadCursor, got %v", bad.cursor, bad.sort, err)
+		}
+	}
+}
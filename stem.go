@@ -0,0 +1,241 @@
+package badger
+
+// An implementation of the Porter stemming algorithm, as described in:
+// M.F. Porter, 1980, "An algorithm for suffix stripping", Program, 14(3)
+// (following the published reference implementation where it differs
+// from the paper, eg "bli" => "ble" and "logi" => "log").
+
+// EnglishAnalyzer is the StandardAnalyzer, with English stemming applied
+// to each token (so eg "lemons" matches "lemon" and "running" matches
+// "runs"). It's registered as "english".
+var EnglishAnalyzer = NewStemmingAnalyzer(StandardAnalyzer)
+
+// NewStemmingAnalyzer returns an analyzer which applies Stem to the tokens
+// produced by base.
+func NewStemmingAnalyzer(base Analyzer) Analyzer {
+	return AnalyzerFunc(func(text string) []Token {
+		toks := base.Analyze(text)
+		for i, _ := range toks {
+			toks[i].Term = Stem(toks[i].Term)
+		}
+		return toks
+	})
+}
+
+// Stem reduces an English word to it's stem, eg "running" => "run".
+// The word should be lowercase. Words containing anything other than
+// a-z are returned unchanged.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	b := []byte(word)
+	b = stemStep1a(b)
+	b = stemStep1b(b)
+	b = stemStep1c(b)
+	b = stemStep2(b)
+	b = stemStep3(b)
+	b = stemStep4(b)
+	b = stemStep5(b)
+	return string(b)
+}
+
+// isCons returns true if b[i] is a consonant
+func isCons(b []byte, i int) bool {
+	switch b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !isCons(b, i-1)
+	}
+	return true
+}
+
+// measure returns the number of vowel-consonant sequences in b
+// ie m in [C](VC){m}[V]
+func measure(b []byte) int {
+	m := 0
+	i := 0
+	for i < len(b) && isCons(b, i) {
+		i++
+	}
+	for i < len(b) {
+		for i < len(b) && !isCons(b, i) {
+			i++
+		}
+		if i == len(b) {
+			break
+		}
+		for i < len(b) && isCons(b, i) {
+			i++
+		}
+		m++
+	}
+	return m
+}
+
+// hasVowel returns true if b contains a vowel
+func hasVowel(b []byte) bool {
+	for i, _ := range b {
+		if !isCons(b, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsDoubleCons returns true if b ends with a double consonant
+func endsDoubleCons(b []byte) bool {
+	n := len(b)
+	return n >= 2 && b[n-1] == b[n-2] && isCons(b, n-1)
+}
+
+// endsCVC returns true if b ends consonant-vowel-consonant, where the
+// last consonant isn't w, x or y (eg "hop", but not "snow")
+func endsCVC(b []byte) bool {
+	n := len(b)
+	if n < 3 || !isCons(b, n-1) || isCons(b, n-2) || !isCons(b, n-3) {
+		return false
+	}
+	c := b[n-1]
+	return c != 'w' && c != 'x' && c != 'y'
+}
+
+func hasSuffix(b []byte, suffix string) bool {
+	return len(b) >= len(suffix) && string(b[len(b)-len(suffix):]) == suffix
+}
+
+// stemRule replaces a suffix, if the remaining stem passes a condition
+type stemRule struct {
+	suffix, repl string
+}
+
+// applyRules finds the first rule with a matching suffix, and applies it
+// if the stem has a measure greater than minM.
+func applyRules(b []byte, rules []stemRule, minM int) []byte {
+	for _, r := range rules {
+		if !hasSuffix(b, r.suffix) {
+			continue
+		}
+		stem := b[:len(b)-len(r.suffix)]
+		if measure(stem) > minM {
+			return append(stem, r.repl...)
+		}
+		return b
+	}
+	return b
+}
+
+func stemStep1a(b []byte) []byte {
+	switch {
+	case hasSuffix(b, "sses"):
+		return b[:len(b)-2]
+	case hasSuffix(b, "ies"):
+		return b[:len(b)-2]
+	case hasSuffix(b, "ss"):
+		return b
+	case hasSuffix(b, "s"):
+		return b[:len(b)-1]
+	}
+	return b
+}
+
+func stemStep1b(b []byte) []byte {
+	if hasSuffix(b, "eed") {
+		if measure(b[:len(b)-3]) > 0 {
+			return b[:len(b)-1]
+		}
+		return b
+	}
+	var stem []byte
+	switch {
+	case hasSuffix(b, "ed") && hasVowel(b[:len(b)-2]):
+		stem = b[:len(b)-2]
+	case hasSuffix(b, "ing") && hasVowel(b[:len(b)-3]):
+		stem = b[:len(b)-3]
+	default:
+		return b
+	}
+
+	// tidy up what's left
+	switch {
+	case hasSuffix(stem, "at"), hasSuffix(stem, "bl"), hasSuffix(stem, "iz"):
+		return append(stem, 'e')
+	case endsDoubleCons(stem):
+		c := stem[len(stem)-1]
+		if c != 'l' && c != 's' && c != 'z' {
+			return stem[:len(stem)-1]
+		}
+	case measure(stem) == 1 && endsCVC(stem):
+		return append(stem, 'e')
+	}
+	return stem
+}
+
+func stemStep1c(b []byte) []byte {
+	if hasSuffix(b, "y") && hasVowel(b[:len(b)-1]) {
+		b[len(b)-1] = 'i'
+	}
+	return b
+}
+
+var step2Rules = []stemRule{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"bli", "ble"}, {"alli", "al"}, {"entli", "ent"},
+	{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+	{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+	{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+	{"logi", "log"},
+}
+
+func stemStep2(b []byte) []byte {
+	return applyRules(b, step2Rules, 0)
+}
+
+var step3Rules = []stemRule{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+func stemStep3(b []byte) []byte {
+	return applyRules(b, step3Rules, 0)
+}
+
+// (longer suffixes first, where one ends with another)
+var step4Rules = []stemRule{
+	{"al", ""}, {"ance", ""}, {"ence", ""}, {"er", ""}, {"ic", ""},
+	{"able", ""}, {"ible", ""}, {"ant", ""}, {"ement", ""}, {"ment", ""},
+	{"ent", ""}, {"ion", ""}, {"ou", ""}, {"ism", ""}, {"ate", ""},
+	{"iti", ""}, {"ous", ""}, {"ive", ""}, {"ize", ""},
+}
+
+func stemStep4(b []byte) []byte {
+	if hasSuffix(b, "ion") {
+		// only after s or t
+		stem := b[:len(b)-3]
+		if len(stem) > 0 && (stem[len(stem)-1] == 's' || stem[len(stem)-1] == 't') && measure(stem) > 1 {
+			return stem
+		}
+		return b
+	}
+	return applyRules(b, step4Rules, 1)
+}
+
+func stemStep5(b []byte) []byte {
+	if hasSuffix(b, "e") {
+		stem := b[:len(b)-1]
+		m := measure(stem)
+		if m > 1 || (m == 1 && !endsCVC(stem)) {
+			b = stem
+		}
+	}
+	if hasSuffix(b, "ll") && measure(b) > 1 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
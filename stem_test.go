@@ -0,0 +1,87 @@
+package badger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := []struct{ in, expect string }{
+		// examples from the paper
+		{"caresses", "caress"}, {"ponies", "poni"}, {"ties", "ti"},
+		{"caress", "caress"}, {"cats", "cat"},
+		{"feed", "feed"}, {"agreed", "agre"}, {"plastered", "plaster"},
+		{"bled", "bled"}, {"motoring", "motor"}, {"sing", "sing"},
+		{"conflated", "conflat"}, {"troubled", "troubl"}, {"sized", "size"},
+		{"hopping", "hop"}, {"tanned", "tan"}, {"falling", "fall"},
+		{"hissing", "hiss"}, {"fizzed", "fizz"}, {"failing", "fail"},
+		{"filing", "file"}, {"happy", "happi"}, {"sky", "sky"},
+		{"relational", "relat"}, {"conditional", "condit"}, {"rational", "ration"},
+		{"valenci", "valenc"}, {"digitizer", "digit"}, {"conformabli", "conform"},
+		{"radicalli", "radic"}, {"differentli", "differ"}, {"vileli", "vile"},
+		{"analogousli", "analog"}, {"vietnamization", "vietnam"},
+		{"predication", "predic"}, {"operator", "oper"}, {"feudalism", "feudal"},
+		{"decisiveness", "decis"}, {"hopefulness", "hope"}, {"callousness", "callous"},
+		{"formaliti", "formal"}, {"sensitiviti", "sensit"}, {"sensibiliti", "sensibl"},
+		{"triplicate", "triplic"}, {"formative", "form"}, {"formalize", "formal"},
+		{"electriciti", "electr"}, {"electrical", "electr"}, {"hopeful", "hope"},
+		{"goodness", "good"}, {"revival", "reviv"}, {"allowance", "allow"},
+		{"inference", "infer"}, {"airliner", "airlin"}, {"gyroscopic", "gyroscop"},
+		{"adjustable", "adjust"}, {"defensible", "defens"}, {"irritant", "irrit"},
+		{"replacement", "replac"}, {"adjustment", "adjust"}, {"dependent", "depend"},
+		{"adoption", "adopt"}, {"homologou", "homolog"}, {"communism", "commun"},
+		{"activate", "activ"}, {"angulariti", "angular"}, {"homologous", "homolog"},
+		{"effective", "effect"}, {"bowdlerize", "bowdler"},
+		{"probate", "probat"}, {"rate", "rate"}, {"cease", "ceas"},
+		{"controll", "control"}, {"roll", "roll"},
+		// the ones our editors care about
+		{"running", "run"}, {"runs", "run"}, {"lemons", "lemon"}, {"lemon", "lemon"},
+		// left alone
+		{"a", "a"}, {"is", "is"}, {"2010s", "2010s"}, {"café", "café"},
+	}
+	for _, test := range tests {
+		if got := Stem(test.in); got != test.expect {
+			t.Errorf("Stem(%q): got %q, expected %q", test.in, got, test.expect)
+		}
+	}
+}
+
+type StemDoc struct {
+	Title   string `badger:",wholeword"`
+	Content string `badger:",wholeword,analyzer=english"`
+}
+
+func TestStemmedSearch(t *testing.T) {
+	coll := NewCollection(&StemDoc{})
+	coll.Put(&StemDoc{"Lemons", "Squeeze a lemon while running."})
+	coll.Put(&StemDoc{"Lemon", "She runs with lemons."})
+
+	for _, test := range []struct {
+		q      Query
+		expect string
+	}{
+		{NewContainsQuery("content", "lemons"), "Lemon,Lemons"},
+		{NewContainsQuery("content", "LEMON"), "Lemon,Lemons"},
+		{NewContainsQuery("content", "running"), "Lemon,Lemons"},
+		{NewContainsQuery("content", "run with lemon"), "Lemon"},
+		// not stemmed
+		{NewContainsQuery("title", "lemon"), "Lemon"},
+	} {
+		var docs []*StemDoc
+		coll.FindWithOptions(test.q, &docs, FindOptions{Sort: []SortKey{{"title", Asc}}})
+		names := []string{}
+		for _, doc := range docs {
+			names = append(names, doc.Title)
+		}
+		if got := strings.Join(names, ","); got != test.expect {
+			t.Errorf("%s: got %q, expected %q", test.q, got, test.expect)
+		}
+	}
+
+	// stemming can be switched on per field
+	coll.SetFieldAnalyzer("title", EnglishAnalyzer)
+	scored, _, err := coll.FindScored(NewContainsQuery("title", "lemon"), FindOptions{})
+	if err != nil || len(scored) != 2 {
+		t.Errorf("expected 2 matches after switching on stemming, got %d (%v)", len(scored), err)
+	}
+}
@@ -0,0 +1,98 @@
+package badger
+
+import (
+	"strings"
+	"sync"
+)
+
+// NewStopwordAnalyzer returns an analyzer which drops any tokens produced
+// by base which are stopwords (common words like "the" and "of", which
+// aren't much use for searching). The dropped tokens leave gaps in the
+// positions, so phrases still have to line up, eg "history of cheese"
+// matches "history of cheese" and "history and cheese", but not
+// "history cheese".
+// The stopwords are run through base too, so they match up with it's
+// tokens (eg if base does stemming).
+// A search made up only of stopwords matches anything (as an empty search
+// would).
+func NewStopwordAnalyzer(base Analyzer, stopwords []string) Analyzer {
+	stop := map[string]struct{}{}
+	for _, word := range stopwords {
+		for _, tok := range base.Analyze(word) {
+			stop[tok.Term] = struct{}{}
+			// in case the collection is folding diacritics
+			stop[Fold(tok.Term)] = struct{}{}
+		}
+	}
+	return AnalyzerFunc(func(text string) []Token {
+		toks := base.Analyze(text)
+		out := toks[:0]
+		for _, tok := range toks {
+			if _, got := stop[tok.Term]; !got {
+				out = append(out, tok)
+			}
+		}
+		return out
+	})
+}
+
+// Stopwords returns the stopword list for a language (by ISO 639-1 code,
+// eg "en" or "fr"), or nil if there isn't one.
+// Built-in lists are provided for en, fr, de, es, it, nl and pt.
+func Stopwords(lang string) []string {
+	stopwordLists.RLock()
+	defer stopwordLists.RUnlock()
+	return stopwordLists.byLang[strings.ToLower(lang)]
+}
+
+// RegisterStopwords adds (or replaces) the stopword list for a language,
+// so it can be used in struct tags (eg `badger:",stopwords=xx"`).
+// Lists need to be registered before any collections which use them are
+// created.
+func RegisterStopwords(lang string, words []string) {
+	stopwordLists.Lock()
+	defer stopwordLists.Unlock()
+	stopwordLists.byLang[strings.ToLower(lang)] = words
+}
+
+// the stopword lists, by language
+var stopwordLists = struct {
+	sync.RWMutex
+	byLang map[string][]string
+}{
+	byLang: map[string][]string{
+		"en": strings.Fields(`a an and are as at be but by for if in into is it
+			no not of on or such that the their then there these they this to
+			was will with`),
+		"fr": strings.Fields(`au aux avec ce ces dans de des du elle en et eux
+			il je la le les leur lui ma mais me même mes moi mon ne nos notre
+			nous on ou par pas pour qu que qui sa se ses son sur ta te tes toi
+			ton tu un une vos votre vous c d j l à m n s t y été étée étées
+			étés étant suis es est sommes êtes sont`),
+		"de": strings.Fields(`aber alle als also am an auch auf aus bei bin bis
+			bist da damit dann das dass dem den der des die dies doch du durch
+			ein eine einem einen einer eines er es für hat hatte ich ihr im in
+			ist ja jede kann kein mit nach nicht noch nun nur ob oder sich sie
+			sind so um und uns unter vom von vor war was weil wenn wie wir wird
+			zu zum zur über`),
+		"es": strings.Fields(`a al algo como con de del donde el ella ellas ellos
+			en entre era es esta este esto estos fue ha han hay la las le les
+			lo los más me mi mis muy ni no nos o os para pero por que qué se
+			sea ser si sin sobre son su sus también te tu un una uno unos y ya
+			yo`),
+		"it": strings.Fields(`a ad al alla alle agli ai anche che chi ci come con
+			da dal dalla dei del della delle di dove e è gli ha hanno i il in
+			io la le lei lo loro lui ma mi ne nel nella noi non o per più quale
+			quando questa questo se si sono su sua suo sul sulla ti tra tu un
+			una uno voi`),
+		"nl": strings.Fields(`aan al als bij dan dat de die dit door een en er
+			haar had heb hebben het hij hoe hun ik in is je kan maar me met mij
+			naar niet nog nu of om ook op over te tot u uit van voor was wat
+			we wel wie wij zal ze zich zij zijn zo`),
+		"pt": strings.Fields(`a ao aos as até com como da das de dela dele do
+			dos e ela elas ele eles em entre era essa esse esta este eu foi há
+			isso isto já lhe mais mas me mesmo meu minha muito na nas nem no
+			nos nós num numa o os ou para pela pelo por quando que se sem ser
+			seu sua são também te tem um uma você`),
+	},
+}
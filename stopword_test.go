@@ -0,0 +1,41 @@
+package badger
+
+import (
+	"testing"
+)
+
+type BookDoc struct {
+	Title    string   `badger:",wholeword,stopwords=en"`
+	Subjects []string `badger:",wholeword,analyzer=english,stopwords=en"`
+	French   string   `badger:",wholeword,stopwords=fr"`
+}
+
+func TestStopwords(t *testing.T) {
+	coll := NewCollection(&BookDoc{})
+	coll.Put(&BookDoc{"A History of Cheese", []string{"cheese and the", "history"}, "L'histoire du fromage"})
+	coll.Put(&BookDoc{"History and Cheese", []string{"this history"}, "Histoire et fromage"})
+	coll.Put(&BookDoc{"History, Cheese", nil, ""})
+
+	assertQueries(t, "stopwords", coll, "title", []queryTest{
+		{NewContainsQuery("title", "history of cheese"), "A History of Cheese,History and Cheese"},
+		{NewContainsQuery("title", "history cheese"), "History, Cheese"},
+		{NewContainsQuery("title", "the history"), "A History of Cheese,History and Cheese,History, Cheese"},
+		{NewContainsQuery("title", "a"), "A History of Cheese,History and Cheese,History, Cheese"},
+		// stopwords at the end of one value mustn't join it to the next
+		{NewContainsQuery("subjects", "cheese and the history"), ""},
+		{NewContainsQuery("subjects", "cheeses"), "A History of Cheese"},
+		{NewContainsQuery("french", "histoire de fromage"), "History and Cheese"},
+	})
+
+	// "this" stems to "thi", which should be dropped too
+	toks := NewStopwordAnalyzer(EnglishAnalyzer, Stopwords("en")).Analyze("this history")
+	if len(toks) != 1 || toks[0] != (Token{"histori", 1}) {
+		t.Errorf("stemmed stopwords: got %v", toks)
+	}
+
+	coll.SetFieldAnalyzer("title", NewStopwordAnalyzer(StandardAnalyzer, []string{"of", "and", "or"}))
+	assertQueries(t, "custom stopwords", coll, "title", []queryTest{
+		{NewContainsQuery("title", "history or cheese"), "A History of Cheese,History and Cheese"},
+		{NewContainsQuery("title", "a history"), "A History of Cheese"},
+	})
+}
@@ -0,0 +1,70 @@
+package badger
+
+import (
+	"strings"
+)
+
+// Synonyms maps search terms to alternatives which should be searched for
+// too, eg "uk" => "united kingdom", "britain". Synonyms can be phrases.
+// The mapping only goes one way - use NewSynonymGroups for sets of
+// interchangeable terms.
+type Synonyms map[string][]string
+
+// NewSynonymGroups returns Synonyms where each term in a group maps to all
+// the others, eg {"uk", "united kingdom", "britain"}.
+func NewSynonymGroups(groups ...[]string) Synonyms {
+	syn := Synonyms{}
+	for _, group := range groups {
+		for _, term := range group {
+			for _, other := range group {
+				if other != term {
+					syn[term] = append(syn[term], other)
+				}
+			}
+		}
+	}
+	return syn
+}
+
+// SetSynonyms attaches synonyms to a field, or to the whole collection if
+// fieldName is "". Field synonyms are used in addition to the collection
+// ones. Pass nil to remove them.
+// Synonyms are used by the query parser (see query.ParseWithSynonyms) to
+// expand searches - Find doesn't do anything with them.
+func (coll *Collection) SetSynonyms(fieldName string, syn Synonyms) {
+	coll.Lock()
+	defer coll.Unlock()
+	field := strings.ToLower(fieldName)
+	if syn == nil {
+		delete(coll.synonyms, field)
+		return
+	}
+	// keep our own (lowercased) copy
+	cpy := Synonyms{}
+	for term, alts := range syn {
+		term = strings.ToLower(strings.TrimSpace(term))
+		cpy[term] = append(cpy[term], alts...)
+	}
+	coll.synonyms[field] = cpy
+}
+
+// Synonyms returns the synonyms of term in a field (or for the whole
+// collection, if fieldName is ""), not including term itself.
+// It's suitable for passing to query.ParseWithSynonyms.
+func (coll *Collection) Synonyms(fieldName, term string) []string {
+	coll.RLock()
+	defer coll.RUnlock()
+	term = strings.ToLower(strings.TrimSpace(term))
+	out := []string{}
+	seen := map[string]struct{}{term: struct{}{}}
+	for _, field := range []string{strings.ToLower(fieldName), ""} {
+		for _, alt := range coll.synonyms[field][term] {
+			if _, got := seen[strings.ToLower(alt)]; got {
+				continue
+			}
+			seen[strings.ToLower(alt)] = struct{}{}
+			out = append(out, alt)
+		}
+	}
+	return out
+}
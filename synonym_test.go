@@ -0,0 +1,35 @@
+package badger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSynonyms(t *testing.T) {
+	coll := NewCollection(&TestDoc{})
+	coll.SetSynonyms("", NewSynonymGroups([]string{"uk", "United Kingdom", "britain"}))
+	coll.SetSynonyms("colour", Synonyms{"Red": {"crimson", "scarlet"}, "UK": {"britain", "blighty"}})
+
+	for _, test := range []struct {
+		field, term string
+		expect      string
+	}{
+		{"", "uk", "United Kingdom,britain"},
+		{"", "united kingdom", "uk,britain"},
+		{"tags", "UK", "United Kingdom,britain"},
+		{"colour", "uk", "britain,blighty,United Kingdom"},
+		{"Colour", "red", "crimson,scarlet"},
+		{"", "red", ""},
+		{"colour", "blue", ""},
+	} {
+		got := strings.Join(coll.Synonyms(test.field, test.term), ",")
+		if got != test.expect {
+			t.Errorf("Synonyms(%q, %q): got %q, expected %q", test.field, test.term, got, test.expect)
+		}
+	}
+
+	coll.SetSynonyms("colour", nil)
+	if got := coll.Synonyms("colour", "red"); len(got) != 0 {
+		t.Errorf("synonyms not removed: got %v", got)
+	}
+}
@@ -0,0 +1,206 @@
+package badger
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// fieldTag holds the settings from a `badger:"..."` struct tag.
+// The tag holds the name to use for the field in queries, followed by any
+// options, eg:
+//
+//	Headline string   `badger:"title,wholeword,default"`
+//	Tags     []string `badger:",index=exact"`
+//	Secret   string   `badger:"-"`
+//
+// A name of "-" hides the field from badger entirely. Options are:
+//
+//	wholeword      require whole-word matching (see SetWholeWordField)
+//	index=range    add a RangeIndex (see AddIndex)
+//	index=exact    add an ExactIndex
+//	default        make it the DefaultField
+//	noquery        don't allow the field to be queried
+//	hidden         leave the field out of ValidFields (but still queryable)
+//	analyzer=NAME  choose the analyzer for the field (see RegisterAnalyzer)
+//	stopwords=LANG drop stopwords for the language (see Stopwords)
+type fieldTag struct {
+	// name replaces the Go field name in queries (empty if not set)
+	name      string
+	ignore    bool
+	wholeWord bool
+	indexes   []IndexType
+	isDefault bool
+	noQuery   bool
+	hidden    bool
+	analyzer  string
+	stopwords string
+}
+
+// parseTag reads the badger tag on a field.
+// Panics if the tag is malformed (it's a bug in the doc type).
+func parseTag(sf reflect.StructField) fieldTag {
+	var tag fieldTag
+	raw, ok := sf.Tag.Lookup("badger")
+	if !ok {
+		return tag
+	}
+	parts := strings.Split(raw, ",")
+	tag.name = parts[0]
+	if tag.name == "-" && len(parts) == 1 {
+		tag.ignore = true
+		tag.name = ""
+		return tag
+	}
+	if strings.ContainsAny(tag.name, ". ") {
+		panic(fmt.Sprintf("badger tag on %s: bad name '%s'", sf.Name, tag.name))
+	}
+	for _, opt := range parts[1:] {
+		key, val, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		switch key {
+		case "":
+		case "wholeword":
+			tag.wholeWord = true
+		case "index":
+			switch val {
+			case "range":
+				tag.indexes = append(tag.indexes, RangeIndex)
+			case "exact":
+				tag.indexes = append(tag.indexes, ExactIndex)
+			default:
+				panic(fmt.Sprintf("badger tag on %s: unknown index type '%s'", sf.Name, val))
+			}
+		case "default":
+			tag.isDefault = true
+		case "noquery":
+			tag.noQuery = true
+		case "hidden":
+			tag.hidden = true
+		case "analyzer":
+			if _, got := lookupAnalyzer(val); !got {
+				panic(fmt.Sprintf("badger tag on %s: unknown analyzer '%s'", sf.Name, val))
+			}
+			tag.analyzer = val
+		case "stopwords":
+			if Stopwords(val) == nil {
+				panic(fmt.Sprintf("badger tag on %s: no stopwords for '%s'", sf.Name, val))
+			}
+			tag.stopwords = val
+		default:
+			panic(fmt.Sprintf("badger tag on %s: unknown option '%s'", sf.Name, opt))
+		}
+	}
+	return tag
+}
+
+// queryName returns the name a field goes by in queries
+func (tag *fieldTag) queryName(sf reflect.StructField) string {
+	if tag.name != "" {
+		return tag.name
+	}
+	return sf.Name
+}
+
+// promoted returns true if the fields of an embedded struct should be
+// treated as fields of the outer struct (as Go does, unless the tag
+// gives the embedded struct a name of it's own).
+func (tag *fieldTag) promoted(sf reflect.StructField) bool {
+	return sf.Anonymous && tag.name == "" && structType(sf.Type) != nil
+}
+
+// lookupField finds a field in the struct type typ by it's query name
+// (case-insensitively). As with reflect.Type.FieldByName, fields of
+// embedded structs are promoted, with shallower fields taking precedence.
+func lookupField(typ reflect.Type, name string) (reflect.StructField, fieldTag, bool) {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	name = strings.ToLower(name)
+	current := []embedded{{typ, nil}}
+	visited := map[reflect.Type]struct{}{}
+	for len(current) > 0 {
+		var next []embedded
+		var match reflect.StructField
+		var matchTag fieldTag
+		cnt := 0
+		for _, e := range current {
+			if _, got := visited[e.typ]; got {
+				continue
+			}
+			visited[e.typ] = struct{}{}
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				tag := parseTag(sf)
+				if tag.ignore {
+					continue
+				}
+				index := append(append([]int{}, e.index...), i)
+				if strings.ToLower(tag.queryName(sf)) == name {
+					match, matchTag = sf, tag
+					match.Index = index
+					cnt++
+				}
+				if tag.promoted(sf) {
+					next = append(next, embedded{structType(sf.Type), index})
+				}
+			}
+		}
+		if cnt == 1 {
+			return match, matchTag, true
+		}
+		if cnt > 1 {
+			// ambiguous
+			break
+		}
+		current = next
+	}
+	return reflect.StructField{}, fieldTag{}, false
+}
+
+// applyTags sets up the collection according to the badger tags in the
+// struct type typ (and any nested structs).
+func (coll *Collection) applyTags(typ reflect.Type, prefix string, seen map[reflect.Type]struct{}) {
+	seen[typ] = struct{}{}
+	defer delete(seen, typ)
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		tag := parseTag(sf)
+		if tag.ignore {
+			continue
+		}
+		if st := structType(sf.Type); st != nil {
+			if _, got := seen[st]; got {
+				continue
+			}
+			if tag.promoted(sf) {
+				coll.applyTags(st, prefix, seen)
+			} else {
+				coll.applyTags(st, prefix+tag.queryName(sf)+".", seen)
+			}
+			continue
+		}
+
+		name := prefix + tag.queryName(sf)
+		if tag.analyzer != "" || tag.stopwords != "" {
+			// (set before the whole-word index is built)
+			a := StandardAnalyzer
+			if tag.analyzer != "" {
+				a, _ = lookupAnalyzer(tag.analyzer)
+			}
+			if tag.stopwords != "" {
+				a = NewStopwordAnalyzer(a, Stopwords(tag.stopwords))
+			}
+			coll.fieldAnalyzers[strings.ToLower(name)] = a
+		}
+		if tag.wholeWord {
+			coll.SetWholeWordField(name)
+		}
+		for _, typ := range tag.indexes {
+			coll.AddIndex(name, typ)
+		}
+		if tag.isDefault {
+			coll.DefaultField = name
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package badger
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type TaggedSub struct {
+	Name string `badger:"who,index=exact"`
+	Note string `badger:",noquery"`
+}
+
+type TaggedDoc struct {
+	Headline string   `badger:"title,wholeword,default"`
+	Body     string   `badger:",wholeword,analyzer=standard"`
+	Count    int      `badger:"n,index=range"`
+	Tags     []string `badger:",index=exact,index=range"`
+	Secret   string   `badger:"-"`
+	Internal string   `badger:",hidden"`
+	Private  string   `badger:",noquery"`
+	Author   TaggedSub
+	TaggedSub `badger:"sub"`
+}
+
+func TestTags(t *testing.T) {
+	coll := NewCollection(&TaggedDoc{})
+
+	got := strings.Join(coll.ValidFields(), ",")
+	expect := "title,Body,n,Tags,Author.who,sub.who"
+	if got != expect {
+		t.Errorf("ValidFields: got %s, expected %s", got, expect)
+	}
+	if len(coll.Fields()) != 9 {
+		t.Errorf("Fields: expected 9 fields (including noquery ones), got %d", len(coll.Fields()))
+	}
+
+	if coll.DefaultField != "title" {
+		t.Errorf("DefaultField: got '%s'", coll.DefaultField)
+	}
+	for _, field := range []string{"title", "body"} {
+		if _, got := coll.wordIndexes[field]; !got {
+			t.Errorf("%s should be whole-word", field)
+		}
+	}
+	for _, field := range []string{"n", "tags"} {
+		if _, got := coll.rangeIndexes[field]; !got {
+			t.Errorf("%s should have a range index", field)
+		}
+	}
+	for _, field := range []string{"tags", "author.who", "sub.who"} {
+		if _, got := coll.exactIndexes[field]; !got {
+			t.Errorf("%s should have an exact index", field)
+		}
+	}
+	if _, got := coll.fieldAnalyzers["body"]; !got {
+		t.Errorf("body analyzer not set")
+	}
+
+	coll.Put(&TaggedDoc{Headline: "History of cheese", Count: 3, Secret: "x", Internal: "x", Private: "x",
+		Author: TaggedSub{"Bob", "x"}, TaggedSub: TaggedSub{"Alice", "x"}})
+	coll.Put(&TaggedDoc{Headline: "Tory cheese", Count: 10, Author: TaggedSub{"Carol", ""}})
+
+	for _, test := range []struct {
+		q      Query
+		expect int
+	}{
+		{NewContainsQuery("title", "tory"), 1},
+		{NewRangeQuery("n", "1", "5"), 1},
+		{NewExactQuery("author.who", "bob"), 1},
+		{NewExactQuery("sub.who", "alice"), 1},
+		{NewContainsQuery("internal", "x"), 1},
+	} {
+		var docs []*TaggedDoc
+		if err := coll.FindErr(test.q, &docs); err != nil {
+			t.Errorf("%s: %s", test.q, err)
+		} else if len(docs) != test.expect {
+			t.Errorf("%s: got %d docs, expected %d", test.q, len(docs), test.expect)
+		}
+	}
+
+	// fields go by their tag names only
+	var docs []*TaggedDoc
+	for _, field := range []string{"headline", "secret", "who", "taggedsub.who"} {
+		if err := coll.FindErr(NewContainsQuery(field, "x"), &docs); !errors.Is(err, ErrUnknownField) {
+			t.Errorf("%s: expected ErrUnknownField, got %v", field, err)
+		}
+	}
+	for _, field := range []string{"private", "author.note"} {
+		if err := coll.FindErr(NewContainsQuery(field, "x"), &docs); !errors.Is(err, ErrUnsupportedField) {
+			t.Errorf("%s: expected ErrUnsupportedField, got %v", field, err)
+		}
+	}
+}
+
+func TestBadTags(t *testing.T) {
+	type BadIndex struct {
+		Name string `badger:",index=hash"`
+	}
+	type BadOption struct {
+		Name string `badger:",wholewrod"`
+	}
+	type BadName struct {
+		Name string `badger:"a.b"`
+	}
+	type BadAnalyzer struct {
+		Name string `badger:",analyzer=wibble"`
+	}
+	for _, doc := range []interface{}{&BadIndex{}, &BadOption{}, &BadName{}, &BadAnalyzer{}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%T: expected panic", doc)
+				}
+			}()
+			NewCollection(doc)
+		}()
+	}
+}
+
+func TestSchema(t *testing.T) {
+	coll := NewCollection(&TaggedDoc{})
+	typ := reflect.TypeOf(TaggedDoc{})
+	for _, path := range []string{"title", "Body", "n", "tags", "internal", "private",
+		"author", "author.who", "author.note", "sub", "sub.who", "sub.note"} {
+		fp, got := coll.schema[strings.ToLower(path)]
+		if !got {
+			t.Errorf("%s: not in schema", path)
+			continue
+		}
+		expect, _ := resolvePath(typ, path)
+		if !reflect.DeepEqual(fp, expect) {
+			t.Errorf("%s: got %+v, expected %+v", path, fp, expect)
+		}
+	}
+	for _, path := range []string{"headline", "secret", "who", "taggedsub.who", "author.wibble"} {
+		if _, got := coll.resolveField(path); got {
+			t.Errorf("%s: shouldn't resolve", path)
+		}
+	}
+
+	// recursive types are only cached one level deep
+	coll = NewCollection(&OwnerDoc{})
+	if _, got := coll.schema["friends.name"]; !got {
+		t.Errorf("friends.name should be in schema")
+	}
+	if _, got := coll.schema["friends.friends.name"]; got {
+		t.Errorf("friends.friends.name shouldn't be in schema")
+	}
+	if fp, got := coll.resolveField("friends.friends.name"); !got || fp.Name != "Friends.Friends.Name" {
+		t.Errorf("friends.friends.name: got %v", fp)
+	}
+}
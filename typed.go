@@ -0,0 +1,137 @@
+package badger
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// TypedCollection wraps a Collection to give a type-safe API, so passing
+// the wrong type of doc is a compile error rather than a panic.
+// The rest of the Collection methods (Count, AddIndex, Save etc) are
+// available as usual.
+type TypedCollection[T any] struct {
+	*Collection
+}
+
+// NewTypedCollection initialises a collection for holding docs of type T
+// (which must be a struct).
+func NewTypedCollection[T any]() *TypedCollection[T] {
+	return &TypedCollection[T]{NewCollection(new(T))}
+}
+
+// NewTypedCollectionWithKey initialises a collection for holding docs of
+// type T, identified by keyField (see NewCollectionWithKey).
+func NewTypedCollectionWithKey[T any](keyField string) *TypedCollection[T] {
+	return &TypedCollection[T]{NewCollectionWithKey(new(T), keyField)}
+}
+
+// AsTyped wraps an existing collection (eg one returned by Load or
+// OpenLogged). It panics if the collection doesn't hold docs of type T.
+func AsTyped[T any](coll *Collection) *TypedCollection[T] {
+	if t := reflect.TypeOf(new(T)); t != coll.docType {
+		panic(fmt.Sprintf("doc type mismatch (got %s, expecting %s)", t, coll.docType))
+	}
+	return &TypedCollection[T]{coll}
+}
+
+// Put adds a doc to the collection (see Collection.Put)
+func (c *TypedCollection[T]) Put(doc *T) {
+	c.Collection.Put(doc)
+}
+
+// PutErr is the same as Put, but returns an error instead of panicking
+func (c *TypedCollection[T]) PutErr(doc *T) error {
+	return c.Collection.PutErr(doc)
+}
+
+// Remove removes a doc from the collection (see Collection.Remove)
+func (c *TypedCollection[T]) Remove(doc *T) {
+	c.Collection.Remove(doc)
+}
+
+// RemoveErr is the same as Remove, but returns an error instead of panicking
+func (c *TypedCollection[T]) RemoveErr(doc *T) error {
+	return c.Collection.RemoveErr(doc)
+}
+
+// Get returns the doc with the given primary key, or nil if there isn't
+// one (see Collection.Get)
+func (c *TypedCollection[T]) Get(key string) *T {
+	doc := c.Collection.Get(key)
+	if doc == nil {
+		return nil
+	}
+	return doc.(*T)
+}
+
+// Find executes a query and returns the matching docs.
+// Panics upon error (see FindErr).
+func (c *TypedCollection[T]) Find(q Query) []*T {
+	out, err := c.FindErr(q)
+	if err != nil {
+		panic(err.Error())
+	}
+	return out
+}
+
+// FindErr is the same as Find, but returns an error instead of panicking
+func (c *TypedCollection[T]) FindErr(q Query) ([]*T, error) {
+	out, _, err := c.FindWithOptions(q, FindOptions{})
+	return out, err
+}
+
+// FindWithOptions is the same as FindErr, but takes extra options,
+// eg to sort or page the results (see Collection.FindWithOptions).
+func (c *TypedCollection[T]) FindWithOptions(q Query, opts FindOptions) ([]*T, FindInfo, error) {
+	c.RLock()
+	defer c.RUnlock()
+	ids, err := c.perform(q)
+	if err != nil {
+		return nil, FindInfo{}, err
+	}
+	ordered, info, err := c.order(ids, nil, &opts)
+	if err != nil {
+		return nil, info, err
+	}
+	out := make([]*T, len(ordered))
+	for i, id := range ordered {
+		out[i] = c.docs[id].(*T)
+	}
+	return out, info, nil
+}
+
+// Update calls modifyFn upon each doc matching the query, and returns the
+// number of docs visited (see Collection.Update)
+func (c *TypedCollection[T]) Update(q Query, modifyFn func(*T)) int {
+	return c.Collection.Update(q, func(doc interface{}) {
+		modifyFn(doc.(*T))
+	})
+}
+
+// UpdateErr is the same as Update, but returns an error instead of panicking
+func (c *TypedCollection[T]) UpdateErr(q Query, modifyFn func(*T)) (int, error) {
+	return c.Collection.UpdateErr(q, func(doc interface{}) {
+		modifyFn(doc.(*T))
+	})
+}
+
+// Scored is a doc returned by TypedCollection.FindScored, along with it's
+// relevance score
+type Scored[T any] struct {
+	Doc   *T
+	Score float64
+}
+
+// FindScored executes a query and returns the matching docs along with
+// relevance scores, best first (see Collection.FindScored).
+func (c *TypedCollection[T]) FindScored(q Query, opts FindOptions) ([]Scored[T], FindInfo, error) {
+	scored, info, err := c.Collection.FindScored(q, opts)
+	if err != nil {
+		return nil, info, err
+	}
+	out := make([]Scored[T], len(scored))
+	for i, sd := range scored {
+		out[i] = Scored[T]{sd.Doc.(*T), sd.Score}
+	}
+	return out, info, nil
+}
@@ -0,0 +1,35 @@
+package badger
+
+import (
+	"testing"
+)
+
+func TestTypedCollection(t *testing.T) {
+	coll := NewTypedCollectionWithKey[TestDoc]("ID")
+	coll.Put(&TestDoc{"1", "red", []string{"primary"}, SubDoc{}})
+	coll.Put(&TestDoc{"2", "green", []string{"primary"}, SubDoc{}})
+	coll.Put(&TestDoc{"3", "pink", []string{"reddish"}, SubDoc{}})
+
+	out := coll.Find(NewExactQuery("tags", "primary"))
+	if len(out) != 2 {
+		t.Errorf("Find: expected 2 docs, got %d", len(out))
+	}
+
+	cnt := coll.Update(NewExactQuery("colour", "pink"), func(doc *TestDoc) {
+		doc.Colour = "crimson"
+	})
+	if cnt != 1 || coll.Get("3").Colour != "crimson" {
+		t.Error("Update failed")
+	}
+
+	coll.Remove(coll.Get("1"))
+	if coll.Count() != 2 || coll.Get("1") != nil {
+		t.Error("Remove failed")
+	}
+
+	// can wrap an untyped collection
+	typed := AsTyped[TestDoc](dummyCollection())
+	if len(typed.Find(NewAllQuery())) != 5 {
+		t.Error("AsTyped failed")
+	}
+}
@@ -0,0 +1,513 @@
+package badger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A logged collection lives in a directory holding a snapshot and a
+// write-ahead log:
+//
+//   snapshot.N   - a snapshot, as written by Collection.Save
+//   log.N        - changes made since snapshot.N was written
+//
+// N is a generation number, bumped each time the log is compacted.
+// Compaction writes log.N+1 (empty), then snapshot.N+1, then deletes the
+// old pair. Snapshots are written to a temp file and renamed into place, so
+// if we crash part way through, the newest snapshot (and the log with the
+// same number, if any) is always a consistent state.
+//
+// Log format:
+// logMagic, a big-endian uint16 version, then a gob stream of logRecords.
+// Put records are followed by the doc itself.
+// Docs are referred to by their key in the collection at the time they were
+// logged. The keys of docs already in the snapshot are stored in the
+// snapshot, which is why the log is always compacted on open - keys don't
+// survive across sessions.
+
+const logMagic = "badgerlog"
+const logVersion = 1
+
+// SyncPolicy determines how often the write-ahead log is flushed to disk
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs the log after every change. Slow but safe.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs the log periodically, so a crash can lose
+	// changes made in the last LogOptions.SyncInterval.
+	SyncInterval
+	// SyncNever leaves it up to the OS to decide when to write the log
+	// to disk.
+	SyncNever
+)
+
+// LogOptions control the behaviour of a logged collection
+type LogOptions struct {
+	Sync SyncPolicy
+	// how often to sync the log for SyncInterval (defaults to 1 second)
+	SyncInterval time.Duration
+	// primary key field, if creating a new collection (see
+	// NewCollectionWithKey). Existing collections use the key from their
+	// snapshot.
+	KeyField string
+}
+
+type logOp uint8
+
+const (
+	logPut logOp = iota + 1
+	logRemove
+)
+
+type logRecord struct {
+	Op  logOp
+	Key uint64
+}
+
+type writeAheadLog struct {
+	dir  string
+	gen  int
+	opts LogOptions
+
+	mu sync.Mutex // guards f, buf, enc, unsynced and err
+	f  *os.File
+	// records are encoded into buf, and only written to f once they're
+	// complete
+	buf      bytes.Buffer
+	enc      *gob.Encoder
+	unsynced bool
+	// error from the background syncing or a failed write (reported by the
+	// next commit). The log can't be trusted after one, so it sticks until
+	// the next compaction.
+	err error
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// OpenLogged opens a logged collection stored in directory dir, creating
+// it if it doesn't exist.
+// Every Put, Remove and Update is written to a log before it is applied,
+// and the log is replayed when the collection is next opened, so changes
+// aren't lost if the process dies.
+// As with NewCollection, referenceDoc gives the type of the documents.
+//
+// Settings (DefaultField, whole-word fields, indexes) aren't logged - they
+// are persisted only when the log is compacted (see Compact).
+// Call Close when finished with the collection.
+func OpenLogged(dir string, referenceDoc interface{}, opts LogOptions) (*Collection, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	gen, err := latestGeneration(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var coll *Collection
+	var docs map[uint64]interface{}
+	if gen > 0 {
+		f, err := os.Open(snapshotPath(dir, gen))
+		if err != nil {
+			return nil, err
+		}
+		coll, docs, err = load(f, referenceDoc)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", snapshotPath(dir, gen), err)
+		}
+	} else if opts.KeyField != "" {
+		coll = NewCollectionWithKey(referenceDoc, opts.KeyField)
+		docs = map[uint64]interface{}{}
+	} else {
+		coll = NewCollection(referenceDoc)
+		docs = map[uint64]interface{}{}
+	}
+
+	f, err := os.Open(logPath(dir, gen))
+	if err == nil {
+		err = coll.replay(f, docs)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", logPath(dir, gen), err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+	wal := &writeAheadLog{dir: dir, gen: gen, opts: opts, stop: make(chan struct{})}
+	coll.wal = wal
+
+	// the replayed keys are meaningless from here on, so start afresh
+	coll.Lock()
+	err = coll.compact()
+	coll.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Sync == SyncInterval {
+		wal.wg.Add(1)
+		go wal.syncLoop()
+	}
+	return coll, nil
+}
+
+// Compact writes a fresh snapshot of a logged collection and starts a new,
+// empty log. This keeps the log from growing forever, and is also the
+// only time settings such as indexes and DefaultField are saved.
+func (coll *Collection) Compact() error {
+	coll.Lock()
+	defer coll.Unlock()
+	if coll.wal == nil {
+		return fmt.Errorf("collection isn't logged")
+	}
+	return coll.compact()
+}
+
+// Close flushes and closes the log of a logged collection.
+// The collection shouldn't be modified afterward.
+func (coll *Collection) Close() error {
+	coll.Lock()
+	defer coll.Unlock()
+	wal := coll.wal
+	if wal == nil {
+		return nil
+	}
+	coll.wal = nil
+
+	close(wal.stop)
+	wal.wg.Wait()
+
+	wal.mu.Lock()
+	defer wal.mu.Unlock()
+	err := wal.f.Sync()
+	if cerr := wal.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// compact writes the next generation of snapshot and log, then
+// discards the old ones. The caller must hold the collection lock.
+func (coll *Collection) compact() error {
+	wal := coll.wal
+	gen := wal.gen + 1
+
+	// start the new log (it's ignored until the new snapshot is in place)
+	lf, err := os.OpenFile(logPath(wal.dir, gen), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = lf.WriteString(logMagic)
+	if err == nil {
+		err = binary.Write(lf, binary.BigEndian, uint16(logVersion))
+	}
+	if err == nil {
+		err = lf.Sync()
+	}
+	if err == nil {
+		err = coll.writeSnapshot(snapshotPath(wal.dir, gen))
+	}
+	if err != nil {
+		lf.Close()
+		os.Remove(logPath(wal.dir, gen))
+		return err
+	}
+
+	// the new snapshot is in place - we're committed.
+	wal.mu.Lock()
+	old := wal.f
+	wal.f = lf
+	wal.buf.Reset()
+	wal.enc = gob.NewEncoder(&wal.buf)
+	wal.unsynced = false
+	wal.err = nil
+	wal.gen = gen
+	wal.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	removeOldGenerations(wal.dir, gen)
+
+	coll.dirty = false
+	return nil
+}
+
+// writeSnapshot atomically writes a snapshot to the file path.
+// The caller must hold the collection lock.
+func (coll *Collection) writeSnapshot(path string) error {
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	err = coll.save(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	// The snapshot is in place now, so too late to fail. Syncing the dir
+	// just makes sure the rename is on disk.
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// replay applies the changes in a log to the collection.
+// docs maps the keys used in the log to docs in the collection, and is
+// updated as we go.
+// A truncated record at the end of the log is assumed to be a write cut
+// short by a crash, and ends the replay. Anything else which can't be
+// decoded is an error.
+func (coll *Collection) replay(r io.Reader, docs map[uint64]interface{}) error {
+	in := bufio.NewReader(r)
+	magic := make([]byte, len(logMagic))
+	if _, err := io.ReadFull(in, magic); err != nil {
+		// crashed before the header was written?
+		return tornWrite(err)
+	}
+	if string(magic) != logMagic {
+		return fmt.Errorf("not a log")
+	}
+	var version uint16
+	if err := binary.Read(in, binary.BigEndian, &version); err != nil {
+		return tornWrite(err)
+	}
+	if version != logVersion {
+		return fmt.Errorf("unsupported log version (%d)", version)
+	}
+
+	elemType := coll.docType.Elem()
+	dec := gob.NewDecoder(in)
+	for {
+		var rec logRecord
+		if err := dec.Decode(&rec); err != nil {
+			return tornWrite(err)
+		}
+		switch rec.Op {
+		case logPut:
+			doc := reflect.New(elemType).Interface()
+			if err := dec.Decode(doc); err != nil {
+				return tornWrite(err)
+			}
+			if old, got := docs[rec.Key]; got {
+				coll.Remove(old)
+			}
+			coll.Put(doc)
+			docs[rec.Key] = doc
+		case logRemove:
+			if old, got := docs[rec.Key]; got {
+				coll.Remove(old)
+				delete(docs, rec.Key)
+			}
+		default:
+			return fmt.Errorf("bad log record (op %d)", rec.Op)
+		}
+	}
+}
+
+// tornWrite returns nil if err shows the log just ends early (ie the last
+// write was cut short), otherwise err.
+func tornWrite(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
+
+// put logs a Put (or the result of an Update) of doc, along with the
+// removal of any docs it replaces (ie which had the same primary key).
+// It all goes into the log in one write, so it can't be half done.
+func (wal *writeAheadLog) put(key uintptr, doc interface{}, replaced []uintptr) error {
+	wal.mu.Lock()
+	defer wal.mu.Unlock()
+	if wal.err != nil {
+		return wal.err
+	}
+	// Make sure the doc can be encoded (eg no unregistered types in
+	// interface fields) before touching the log. A failed Encode would
+	// leave the encoder out of step with what's been written.
+	if err := gob.NewEncoder(io.Discard).Encode(doc); err != nil {
+		return err
+	}
+	for _, old := range replaced {
+		if err := wal.enc.Encode(logRecord{logRemove, uint64(old)}); err != nil {
+			return wal.fail(err)
+		}
+	}
+	if err := wal.enc.Encode(logRecord{logPut, uint64(key)}); err != nil {
+		return wal.fail(err)
+	}
+	if err := wal.enc.Encode(doc); err != nil {
+		return wal.fail(err)
+	}
+	return wal.write()
+}
+
+// remove logs the removal of a doc
+func (wal *writeAheadLog) remove(key uintptr) error {
+	wal.mu.Lock()
+	defer wal.mu.Unlock()
+	if wal.err != nil {
+		return wal.err
+	}
+	if err := wal.enc.Encode(logRecord{logRemove, uint64(key)}); err != nil {
+		return wal.fail(err)
+	}
+	return wal.write()
+}
+
+// write appends the encoded record(s) in buf to the log.
+// The caller must hold wal.mu.
+func (wal *writeAheadLog) write() error {
+	_, err := wal.f.Write(wal.buf.Bytes())
+	wal.buf.Reset()
+	if err != nil {
+		return wal.fail(err)
+	}
+	wal.unsynced = true
+	return nil
+}
+
+// fail records an error which leaves the log in an unknown state, so no
+// more changes are logged until the next compaction.
+// The caller must hold wal.mu.
+func (wal *writeAheadLog) fail(err error) error {
+	wal.buf.Reset()
+	if wal.err == nil {
+		wal.err = err
+	}
+	return err
+}
+
+// commit is called after a change has been logged, and syncs the log
+// according to the SyncPolicy.
+// An error means the change is in the log, but might not be on disk. It's
+// returned wrapped in ErrLogSync.
+func (wal *writeAheadLog) commit() error {
+	wal.mu.Lock()
+	defer wal.mu.Unlock()
+	if wal.err != nil {
+		return fmt.Errorf("%w: %w", ErrLogSync, wal.err)
+	}
+	if wal.opts.Sync != SyncAlways {
+		return nil
+	}
+	wal.unsynced = false
+	if err := wal.f.Sync(); err != nil {
+		return fmt.Errorf("%w: %w", ErrLogSync, wal.fail(err))
+	}
+	return nil
+}
+
+func (wal *writeAheadLog) syncLoop() {
+	defer wal.wg.Done()
+	ticker := time.NewTicker(wal.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-wal.stop:
+			return
+		case <-ticker.C:
+			wal.mu.Lock()
+			if wal.unsynced {
+				wal.unsynced = false
+				if err := wal.f.Sync(); err != nil {
+					wal.fail(err)
+				}
+			}
+			wal.mu.Unlock()
+		}
+	}
+}
+
+func snapshotPath(dir string, gen int) string {
+	return filepath.Join(dir, fmt.Sprintf("snapshot.%d", gen))
+}
+
+func logPath(dir string, gen int) string {
+	return filepath.Join(dir, fmt.Sprintf("log.%d", gen))
+}
+
+// latestGeneration returns the number of the newest snapshot in dir,
+// or 0 if there are none.
+func latestGeneration(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	latest := 0
+	for _, e := range entries {
+		if gen, ok := parseGeneration(e.Name(), "snapshot."); ok && gen > latest {
+			latest = gen
+		}
+	}
+	return latest, nil
+}
+
+// removeOldGenerations deletes any snapshots and logs older than gen
+// (plus any leftover temp files)
+func removeOldGenerations(dir string, gen int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		for _, prefix := range []string{"snapshot.", "log."} {
+			if g, ok := parseGeneration(name, prefix); ok && g < gen {
+				os.Remove(filepath.Join(dir, name))
+			}
+		}
+	}
+}
+
+// parseGeneration extracts the generation number from a filename
+// such as "snapshot.42"
+func parseGeneration(name, prefix string) (int, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return 0, false
+	}
+	gen, err := strconv.Atoi(strings.TrimPrefix(name, prefix))
+	if err != nil {
+		return 0, false
+	}
+	return gen, true
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,310 @@
+package badger
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoggedCollection(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, policy := range []SyncPolicy{SyncAlways, SyncInterval, SyncNever} {
+		dir := filepath.Join(dir, "coll")
+		os.RemoveAll(dir)
+
+		coll, err := OpenLogged(dir, &EventDoc{}, LogOptions{Sync: policy})
+		if err != nil {
+			t.Fatalf("OpenLogged failed: %s", err)
+		}
+		coll.SetWholeWordField("name")
+		coll.AddIndex("date", RangeIndex)
+		if err := coll.Compact(); err != nil {
+			t.Fatalf("Compact failed: %s", err)
+		}
+
+		docs := []*EventDoc{
+			&EventDoc{Name: "one", Date: "2001-01-01", Count: 1},
+			&EventDoc{Name: "two", Date: "2002-02-02", Count: 2},
+			&EventDoc{Name: "three", Date: "2003-03-03", Count: 3},
+		}
+		for _, doc := range docs {
+			coll.Put(doc)
+		}
+		coll.Remove(docs[1])
+		coll.Update(NewExactQuery("name", "three"), func(doc interface{}) {
+			doc.(*EventDoc).Count = 33
+		})
+		// no Close() - as if we'd crashed
+		coll.wal.f.Sync()
+
+		// should get our changes back
+		coll, err = OpenLogged(dir, &EventDoc{}, LogOptions{Sync: policy})
+		if err != nil {
+			t.Fatalf("reopen failed: %s", err)
+		}
+		if coll.Count() != 2 {
+			t.Errorf("expected 2 docs, got %d", coll.Count())
+		}
+		var out []*EventDoc
+		coll.Find(NewRangeQuery("count", "33", "33"), &out)
+		if len(out) != 1 {
+			t.Errorf("update didn't survive")
+		}
+		if _, got := coll.wordIndexes["name"]; !got {
+			t.Errorf("whole-word field didn't survive")
+		}
+
+		// keep going (now with the replayed docs in the snapshot)
+		coll.Remove(out[0])
+		coll.Put(&EventDoc{Name: "four"})
+		if err := coll.Close(); err != nil {
+			t.Fatalf("Close failed: %s", err)
+		}
+
+		coll, err = OpenLogged(dir, &EventDoc{}, LogOptions{Sync: policy})
+		if err != nil {
+			t.Fatalf("reopen failed: %s", err)
+		}
+		if coll.Count() != 2 {
+			t.Errorf("expected 2 docs, got %d", coll.Count())
+		}
+		coll.Find(NewExactQuery("name", "one", "four"), &out)
+		if len(out) != 2 {
+			t.Errorf("wrong docs after second reopen")
+		}
+		coll.Close()
+
+		// only the latest generation should be left
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 2 {
+			t.Errorf("expected just a snapshot and log, got %d files", len(entries))
+		}
+	}
+}
+
+func TestLogTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	coll, err := OpenLogged(dir, &EventDoc{}, LogOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("OpenLogged failed: %s", err)
+	}
+	coll.Put(&EventDoc{Name: "one"})
+	coll.Put(&EventDoc{Name: "two"})
+	coll.Close()
+
+	// simulate a crash part way through writing a record
+	gen, _ := latestGeneration(dir)
+	f, err := os.OpenFile(logPath(dir, gen), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0x17, 0xff, 0x81})
+	f.Close()
+
+	coll, err = OpenLogged(dir, &EventDoc{}, LogOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("reopen failed: %s", err)
+	}
+	defer coll.Close()
+	if coll.Count() != 2 {
+		t.Errorf("expected 2 docs, got %d", coll.Count())
+	}
+}
+
+func TestLoggedKeyedCollection(t *testing.T) {
+	dir := t.TempDir()
+	opts := LogOptions{Sync: SyncNever, KeyField: "name"}
+	coll, err := OpenLogged(dir, &EventDoc{}, opts)
+	if err != nil {
+		t.Fatalf("OpenLogged failed: %s", err)
+	}
+	coll.Put(&EventDoc{Name: "one", Count: 1})
+	coll.Put(&EventDoc{Name: "two", Count: 2})
+	coll.Put(&EventDoc{Name: "one", Count: 11})
+	coll.Remove(&EventDoc{Name: "two"})
+	coll.Put(&EventDoc{Name: "three", Count: 3})
+	coll.Close()
+
+	coll, err = OpenLogged(dir, &EventDoc{}, opts)
+	if err != nil {
+		t.Fatalf("reopen failed: %s", err)
+	}
+	defer coll.Close()
+	if coll.Count() != 2 {
+		t.Errorf("expected 2 docs, got %d", coll.Count())
+	}
+	if doc, ok := coll.Get("one").(*EventDoc); !ok || doc.Count != 11 {
+		t.Errorf("upsert didn't survive (got %v)", doc)
+	}
+}
+
+type LooseDoc struct {
+	Name  string
+	Extra interface{}
+}
+
+type unregisteredExtra struct {
+	X int
+}
+
+func TestLogEncodeFailure(t *testing.T) {
+	dir := t.TempDir()
+	coll, err := OpenLogged(dir, &LooseDoc{}, LogOptions{Sync: SyncAlways})
+	if err != nil {
+		t.Fatalf("OpenLogged failed: %s", err)
+	}
+	coll.Put(&LooseDoc{Name: "a"})
+	if err := coll.PutErr(&LooseDoc{"b", unregisteredExtra{1}}); err == nil {
+		t.Errorf("expected PutErr to fail")
+	}
+	coll.Put(&LooseDoc{Name: "c"})
+	coll.Put(&LooseDoc{Name: "d", Extra: 4})
+	if coll.Count() != 3 {
+		t.Errorf("expected 3 docs, got %d", coll.Count())
+	}
+	// no Close() - as if we'd crashed
+
+	coll, err = OpenLogged(dir, &LooseDoc{}, LogOptions{Sync: SyncAlways})
+	if err != nil {
+		t.Fatalf("reopen failed: %s", err)
+	}
+	defer coll.Close()
+	if coll.Count() != 3 {
+		t.Errorf("after reopen: expected 3 docs, got %d", coll.Count())
+	}
+}
+
+func TestLogCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	coll, err := OpenLogged(dir, &EventDoc{}, LogOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("OpenLogged failed: %s", err)
+	}
+	coll.Put(&EventDoc{Name: "one"})
+	coll.Close()
+
+	// a complete (but bogus) message isn't a torn write
+	gen, _ := latestGeneration(dir)
+	f, err := os.OpenFile(logPath(dir, gen), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0x03, 0xff, 0xff, 0xff})
+	f.Close()
+
+	if _, err := OpenLogged(dir, &EventDoc{}, LogOptions{Sync: SyncNever}); err == nil {
+		t.Errorf("expected an error opening a corrupt log")
+	}
+	// the log should be left alone
+	if _, err := os.Stat(logPath(dir, gen)); err != nil {
+		t.Errorf("log was removed: %s", err)
+	}
+}
+
+func TestLogFailedUpsert(t *testing.T) {
+	dir := t.TempDir()
+	opts := LogOptions{Sync: SyncAlways, KeyField: "name"}
+	coll, err := OpenLogged(dir, &LooseDoc{}, opts)
+	if err != nil {
+		t.Fatalf("OpenLogged failed: %s", err)
+	}
+	coll.Put(&LooseDoc{"a", 1})
+	coll.Put(&LooseDoc{"b", 2})
+
+	// a failed upsert shouldn't lose the doc it was replacing
+	if err := coll.PutErr(&LooseDoc{"a", unregisteredExtra{1}}); err == nil {
+		t.Errorf("expected PutErr to fail")
+	}
+	// nor should a failed update which changes the key
+	_, err = coll.UpdateErr(NewExactQuery("name", "b"), func(doc interface{}) {
+		doc.(*LooseDoc).Name = "a"
+		doc.(*LooseDoc).Extra = unregisteredExtra{2}
+	})
+	if err == nil {
+		t.Errorf("expected UpdateErr to fail")
+	}
+
+	check := func(when string) {
+		if coll.Count() != 2 {
+			t.Errorf("%s: expected 2 docs, got %d", when, coll.Count())
+		}
+		for key, extra := range map[string]int{"a": 1, "b": 2} {
+			doc, ok := coll.Get(key).(*LooseDoc)
+			if !ok || doc.Extra != extra {
+				t.Errorf("%s: Get(%q): got %v", when, key, doc)
+			}
+		}
+	}
+	check("before reopen")
+	coll.Close()
+
+	coll, err = OpenLogged(dir, &LooseDoc{}, opts)
+	if err != nil {
+		t.Fatalf("reopen failed: %s", err)
+	}
+	defer coll.Close()
+	check("after reopen")
+}
+
+func TestLogSyncFailure(t *testing.T) {
+	dir := t.TempDir()
+	coll, err := OpenLogged(dir, &EventDoc{}, LogOptions{Sync: SyncAlways})
+	if err != nil {
+		t.Fatalf("OpenLogged failed: %s", err)
+	}
+	defer coll.Close()
+
+	// writes to a pipe work, but fsync fails
+	breakSync := func() func() {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := coll.wal.f
+		coll.wal.f = w
+		return func() {
+			coll.wal.f = f
+			r.Close()
+			w.Close()
+		}
+	}
+	check := func(what string, err error, expect int) {
+		if !errors.Is(err, ErrLogSync) {
+			t.Errorf("%s: expected ErrLogSync, got %v", what, err)
+		}
+		// the change is made anyway
+		if coll.Count() != expect {
+			t.Errorf("%s: expected %d docs, got %d", what, expect, coll.Count())
+		}
+		// but nothing more is allowed until the log is compacted
+		if err := coll.PutErr(&EventDoc{Name: "nope"}); err == nil || errors.Is(err, ErrLogSync) {
+			t.Errorf("%s: expected later PutErr to fail, got %v", what, err)
+		}
+		if coll.Count() != expect {
+			t.Errorf("%s: later PutErr changed the collection", what)
+		}
+	}
+
+	restore := breakSync()
+	doc := &EventDoc{Name: "one"}
+	check("PutErr", coll.PutErr(doc), 1)
+	restore()
+	if err := coll.Compact(); err != nil {
+		t.Fatalf("Compact failed: %s", err)
+	}
+
+	restore = breakSync()
+	_, err = coll.UpdateErr(NewAllQuery(), func(doc interface{}) { doc.(*EventDoc).Count++ })
+	check("UpdateErr", err, 1)
+	if doc.Count != 1 {
+		t.Errorf("UpdateErr: expected doc to be modified")
+	}
+	restore()
+	coll.Compact()
+
+	restore = breakSync()
+	check("RemoveErr", coll.RemoveErr(doc), 0)
+	restore()
+}
@@ -0,0 +1,105 @@
+package badger
+
+import (
+	"sort"
+)
+
+// wordIndex is an inverted index for a single whole-word field.
+// It maps each token to the docs containing it, along with the positions
+// the token occurs at (so phrases can be matched).
+type wordIndex struct {
+	field    *fieldPath
+	analyzer Analyzer
+	postings map[string]map[uintptr][]int
+	// the distinct tokens in each doc, so we can remove it later
+	docTokens map[uintptr][]string
+	// number of tokens in each doc (and in total), for scoring
+	docLens  map[uintptr]int
+	totalLen int
+}
+
+// valueGap is the gap in positions left between the values of a
+// multi-valued field
+const valueGap = 100
+
+func newWordIndex(field *fieldPath, analyzer Analyzer) *wordIndex {
+	return &wordIndex{
+		field:     field,
+		analyzer:  analyzer,
+		postings:  make(map[string]map[uintptr][]int),
+		docTokens: make(map[uintptr][]string),
+		docLens:   make(map[uintptr]int),
+	}
+}
+
+func (idx *wordIndex) add(id uintptr, doc interface{}) {
+	base := 0
+	cnt := 0
+	tokens := []string{}
+	for _, val := range idx.field.docStrings(doc) {
+		next := base
+		for _, tok := range idx.analyzer.Analyze(val) {
+			docs, got := idx.postings[tok.Term]
+			if !got {
+				docs = make(map[uintptr][]int)
+				idx.postings[tok.Term] = docs
+			}
+			if _, got := docs[id]; !got {
+				tokens = append(tokens, tok.Term)
+			}
+			docs[id] = append(docs[id], base+tok.Pos)
+			next = base + tok.Pos + 1
+			cnt++
+		}
+		// leave a gap between values so phrases can't match across them
+		// (eg the end of one []string item and the start of the next).
+		// It's a big one, as analyzers might have dropped words (eg
+		// stopwords) from the end of the value, which phrases can span.
+		base = next + valueGap
+	}
+	idx.docTokens[id] = tokens
+	idx.docLens[id] = cnt
+	idx.totalLen += cnt
+}
+
+func (idx *wordIndex) remove(id uintptr) {
+	for _, tok := range idx.docTokens[id] {
+		docs := idx.postings[tok]
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(idx.postings, tok)
+		}
+	}
+	delete(idx.docTokens, id)
+	idx.totalLen -= idx.docLens[id]
+	delete(idx.docLens, id)
+}
+
+// lookup returns all the docs containing the phrase.
+// phrase must contain at least one token.
+func (idx *wordIndex) lookup(phrase []Token) docSet {
+	matching := docSet{}
+	for id, positions := range idx.postings[phrase[0].Term] {
+		for _, pos := range positions {
+			if idx.phraseAt(id, phrase, pos) {
+				matching[id] = struct{}{}
+				break
+			}
+		}
+	}
+	return matching
+}
+
+// phraseAt returns true if the phrase occurs in doc id, starting at pos
+// (with the terms at the same relative positions as in the phrase)
+func (idx *wordIndex) phraseAt(id uintptr, phrase []Token, pos int) bool {
+	for _, tok := range phrase[1:] {
+		want := pos + tok.Pos - phrase[0].Pos
+		positions := idx.postings[tok.Term][id]
+		j := sort.SearchInts(positions, want)
+		if j == len(positions) || positions[j] != want {
+			return false
+		}
+	}
+	return true
+}
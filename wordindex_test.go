@@ -0,0 +1,58 @@
+package badger
+
+import (
+	"testing"
+)
+
+type ArticleDoc struct {
+	Title   string
+	Content string
+	Tags    []string
+}
+
+// check that the inverted index gives exactly the same results as a scan
+func TestWordIndex(t *testing.T) {
+	docs := []*ArticleDoc{
+		&ArticleDoc{"Moon made of cheese", "Discredited view from history is proved right after all!", []string{"moon", "cheese"}},
+		&ArticleDoc{"Weekly Citrus Roundup", "Grapefruit are awesome. Lemons suck.", []string{"citrus", "lemon curd"}},
+		&ArticleDoc{"Recipe: Zesty Cheese", "Goes well with grape. - Or grapefruit.", []string{"cheese", "lemon", "curd"}},
+		&ArticleDoc{"Grapefruit is the New Lemon", "Grapefruit on the up, grapefruit on the up.", []string{"citrus"}},
+		&ArticleDoc{"Empty", "", []string{}},
+	}
+
+	queries := []Query{
+		NewContainsQuery("content", "grape"),
+		NewContainsQuery("content", "grapefruit"),
+		NewContainsQuery("content", "GRAPEFRUIT on the"),
+		NewContainsQuery("content", "the up grapefruit"),
+		NewContainsQuery("content", "view from"),
+		NewContainsQuery("content", "right after all"),
+		NewContainsQuery("content", "tory"),
+		NewContainsQuery("content", "grape or"),
+		NewContainsQuery("content", "-"),
+		NewContainsQuery("content", ""),
+		NewContainsQuery("tags", "lemon"),
+		NewContainsQuery("tags", "lemon curd"),
+		NewContainsQuery("tags", "cheese lemon"),
+		NewContainsQuery("tags", ""),
+	}
+
+	coll := NewCollection(&ArticleDoc{})
+	for _, doc := range docs {
+		coll.Put(doc)
+	}
+	coll.SetWholeWordField("content")
+	coll.SetWholeWordField("Tags")
+
+	assertIndexParity(t, "after Put", coll, queries)
+
+	coll.Update(NewContainsQuery("title", "cheese"), func(doc interface{}) {
+		doc.(*ArticleDoc).Content = "Lemon curd with grapefruit"
+	})
+	assertIndexParity(t, "after Update", coll, queries)
+
+	coll.Remove(docs[3])
+	docs[1].Tags = append(docs[1].Tags, "cheese")
+	coll.Put(docs[1])
+	assertIndexParity(t, "after Remove/Put", coll, queries)
+}